@@ -2,6 +2,9 @@ package config
 
 import (
     "errors"
+    "fmt"
+    "strings"
+    "time"
 
     "github.com/dbnski/query-stats/dsn"
 )
@@ -9,22 +12,154 @@ import (
 type CLI struct {
     AskPass bool `
                 help:"Prompt for MySQL password"`
+    Query   string `
+                help:"Run this query instead of reading one from stdin"`
+    QueryFile string `
+                help:"Read the query from this file" 
+                type:"existingfile"`
+    Edit    bool `
+                help:"Compose the query in $EDITOR (starting from --query or a query file, if given)"`
+    Define  []string `
+                help:"Set a template variable for the query (key=value)" 
+                sep:"none"`
+    VarsFile string `
+                help:"Read template variables from a .json object or a file of key=value lines" 
+                type:"existingfile"`
+    Slowlog string `
+                help:"Profile the top queries of a MySQL slow query log" 
+                type:"existingfile"`
+    Digests bool `
+                help:"Profile the top statement digests from performance_schema"`
+    RankBy  string `
+                help:"Rank digests by total latency (time) or rows examined (rows)" 
+                default:"time" 
+                enum:"time,rows"`
+    Top     int `
+                help:"Number of fingerprints or digests to profile with --slowlog or --digests" 
+                default:"10"`
+    Workload string `
+                help:"Run the weighted mix of queries in this JSON file and report latency and payload per query" 
+                type:"existingfile"`
+    Concurrency int `
+                help:"Run the query from this many connections at once and report throughput and latency"`
+    Duration time.Duration `
+                help:"How long to run with --concurrency or --workload (default 30s)"`
+    QPS     float64 `
+                help:"Start queries at this rate across all connections instead of back to back"`
+    Interactive bool `
+                help:"Start an interactive shell that keeps the connection open between queries" 
+                short:"i"`
+    PrintDefaults bool `
+                help:"Print the effective connection settings and where each came from, then exit"`
     SetVar  []string `
-                help:"Set a MySQL session variable (name=value)"`
+                help:"Set a MySQL session variable (name=value, name=@default or name:=expr)" 
+                sep:"none"`
+    InitCommand []string `
+                help:"Run a setup statement before the measured query (repeatable)" 
+                sep:"none"`
+    InitFile string `
+                help:"Run the setup statements in this file before the measured query" 
+                type:"existingfile"`
     Mode    string  `
                 help:"Column size measurement mode: text = COM_QUERY, binary = COM_STMT_EXECUTE" 
                 default:"text" 
                 enum:"binary,text"`
+    MaxExecutionTime time.Duration `
+                help:"Abort the query on the server after this long (sets max_execution_time or max_statement_time)"`
+    AllowWrites bool `
+                help:"Disable the read-only safety check and transaction"`
+    DMLRollback bool `
+                help:"Run INSERT, UPDATE or DELETE inside a transaction and roll it back"`
+    Param   []string `
+                help:"Bind a value to the next ? placeholder (\\N for NULL)" 
+                sep:"none"`
+    SplitStatements bool `
+                help:"Send a batch of statements one at a time and report each one's status changes"`
+    ParamsFile string `
+                help:"Read rows of placeholder values from a .json or .csv file" 
+                type:"existingfile"`
     DSN     *dsn.MySQL `
                 help:"Syntax is mysql://[user[:password]@]host[:port]/[?options]" 
                 required:"" 
                 arg:""`
+    File    string `
+                help:"Read the query from a file, given as @file.sql" 
+                optional:"" 
+                arg:""`
 }
 
 func (cli *CLI) ValidateConfig() error {
     if cli.DSN == nil {
         return errors.New("database endpoint is required")
     }
+    if len(cli.Param) > 0 && cli.ParamsFile != "" {
+        return errors.New("--param and --params-file are mutually exclusive")
+    }
+    if cli.Interactive && (len(cli.Param) > 0 || cli.ParamsFile != "") {
+        return errors.New("--interactive cannot be combined with --param or --params-file")
+    }
+    if cli.File != "" {
+        if !strings.HasPrefix(cli.File, "@") || len(cli.File) == 1 {
+            return fmt.Errorf("unexpected argument %q (query files are given as @file.sql, inline queries with --query)", cli.File)
+        }
+        if cli.QueryFile != "" {
+            return errors.New("--query-file and @file are mutually exclusive")
+        }
+        cli.QueryFile = cli.File[1:]
+    }
+    if cli.Query != "" && cli.QueryFile != "" {
+        return errors.New("--query and a query file are mutually exclusive")
+    }
+    if cli.Interactive && (cli.Query != "" || cli.QueryFile != "" || cli.Edit) {
+        return errors.New("--interactive cannot be combined with --query, --query-file, @file or --edit")
+    }
+    if cli.Slowlog != "" && (cli.Query != "" || cli.QueryFile != "" || cli.Edit || cli.Interactive ||
+        len(cli.Param) > 0 || cli.ParamsFile != "") {
+        return errors.New("--slowlog cannot be combined with another query source, --interactive or parameters")
+    }
+    if cli.Digests && (cli.Slowlog != "" || cli.Query != "" || cli.QueryFile != "" || cli.Edit ||
+        cli.Interactive || len(cli.Param) > 0 || cli.ParamsFile != "") {
+        return errors.New("--digests cannot be combined with another query source, --interactive or parameters")
+    }
+    if cli.Concurrency > 0 && (cli.Slowlog != "" || cli.Digests || cli.Interactive ||
+        len(cli.Param) > 0 || cli.ParamsFile != "") {
+        return errors.New("--concurrency cannot be combined with --slowlog, --digests, --interactive or parameters")
+    }
+    if cli.Concurrency < 0 {
+        return errors.New("--concurrency cannot be negative")
+    }
+    if cli.Duration < 0 {
+        return errors.New("--duration cannot be negative")
+    }
+    if cli.Workload != "" && (cli.Query != "" || cli.QueryFile != "" || cli.Edit ||
+        cli.Slowlog != "" || cli.Digests || cli.Interactive || len(cli.Param) > 0 || cli.ParamsFile != "") {
+        return errors.New("--workload cannot be combined with another query source, --interactive or parameters")
+    }
+    if cli.QPS < 0 {
+        return errors.New("--qps cannot be negative")
+    }
+    if cli.Workload != "" && cli.Concurrency == 0 {
+        cli.Concurrency = 1
+    }
+    if cli.Duration > 0 && cli.Concurrency == 0 {
+        return errors.New("--duration requires --concurrency or --workload")
+    }
+    if cli.QPS > 0 && cli.Concurrency == 0 {
+        return errors.New("--qps requires --concurrency or --workload")
+    }
+    if cli.Concurrency > 0 && cli.Duration == 0 {
+        cli.Duration = 30 * time.Second
+    }
+    if cli.Top < 1 {
+        return errors.New("--top must be at least 1")
+    }
+    if cli.MaxExecutionTime < 0 {
+        return errors.New("max execution time cannot be negative")
+    }
+    // MySQL counts in whole milliseconds and takes 0 as no limit.
+    if cli.MaxExecutionTime > 0 && cli.MaxExecutionTime < time.Millisecond {
+        return errors.New("max execution time must be at least 1ms")
+    }
 
     return nil
 }
@@ -0,0 +1,456 @@
+package dsn
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "fmt"
+    "io/fs"
+    "net/url"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+
+    "gopkg.in/ini.v1"
+)
+
+// maxIncludeDepth guards against !include cycles.
+const maxIncludeDepth = 10
+
+// defaultGroups are read in order; a later group overrides an earlier one.
+var defaultGroups = []string{"client", "mysql", "query-stats"}
+
+// globalOptionFiles are read before defaultsExtraFile and ~/.my.cnf, as by
+// the mysql client on Unix.
+var globalOptionFiles = []string{
+    "/etc/my.cnf",
+    "/etc/mysql/my.cnf",
+}
+
+// defaultsOptions are consumed while resolving the DSN and removed from it.
+var defaultsOptions = []string{
+    "defaultsFile",
+    "defaultsExtraFile",
+    "defaultsGroup",
+    "noDefaults",
+    "loginPath",
+    "passwordFile",
+}
+
+// optionFile is a file in the option file search list. Only files named
+// in the DSN are required to exist.
+type optionFile struct {
+    path     string
+    required bool
+}
+
+// optionFiles returns the option files to read, in order, following the
+// mysql client: defaultsFile replaces the standard list, noDefaults skips
+// option files entirely.
+func optionFiles(q url.Values) []optionFile {
+    if _, ok := q["noDefaults"]; ok {
+        return nil
+    }
+    if f := q.Get("defaultsFile"); f != "" {
+        return []optionFile{{f, true}}
+    }
+    var files []optionFile
+    for _, f := range globalOptionFiles {
+        files = append(files, optionFile{f, false})
+    }
+    if f := q.Get("defaultsExtraFile"); f != "" {
+        files = append(files, optionFile{f, true})
+    }
+    if home, err := os.UserHomeDir(); err == nil {
+        files = append(files, optionFile{filepath.Join(home, ".my.cnf"), false})
+    }
+    return files
+}
+
+// optionGroups returns the groups to read; defaultsGroup replaces the
+// default list.
+func optionGroups(q url.Values) []string {
+    if g := q.Get("defaultsGroup"); g != "" {
+        return []string{g}
+    }
+    return defaultGroups
+}
+
+// envVars are the environment variables the mysql client takes connection
+// settings from, keyed by option name.
+var envVars = []struct{ key, name string }{
+    {"host", "MYSQL_HOST"},
+    {"port", "MYSQL_TCP_PORT"},
+    {"user", "USER"},
+    {"password", "MYSQL_PWD"},
+}
+
+// applyDefaults fills in whatever the DSN leaves unset and returns where
+// each value came from. Sources are consulted from the highest precedence
+// down:
+//
+//  1. the DSN itself
+//  2. passwordFile
+//  3. loginPath
+//  4. option files
+//  5. MYSQL_PWD, MYSQL_HOST, MYSQL_TCP_PORT and USER
+//
+// The current OS user and port 3306 are used when nothing else is set, and
+// AskPass overrides any password.
+func applyDefaults(dsn *url.URL) (map[string]string, error) {
+    q := dsn.Query()
+    origins := make(map[string]string)
+    var cfg iniConfig
+    if err := mergeTracked(&cfg, urlToConfig(dsn), "DSN", origins); err != nil {
+        return nil, err
+    }
+    if f := q.Get("passwordFile"); f != "" && cfg.Password == "" {
+        pass, err := readPasswordFile(f)
+        if err != nil {
+            return nil, err
+        }
+        cfg.Password = pass
+        origins["password"] = "password file " + f
+    }
+    if name := q.Get("loginPath"); name != "" {
+        loginCfg, err := loadLoginPath(name)
+        if err != nil {
+            return nil, err
+        }
+        if err := mergeTracked(&cfg, loginCfg, "login path "+name, origins); err != nil {
+            return nil, err
+        }
+    }
+    if err := mergeOptionFiles(&cfg, optionFiles(q), optionGroups(q), origins); err != nil {
+        return nil, err
+    }
+    for _, e := range envVars {
+        var envCfg iniConfig
+        setConfigKey(&envCfg, e.key, os.Getenv(e.name))
+        if err := mergeTracked(&cfg, envCfg, "environment "+e.name, origins); err != nil {
+            return nil, err
+        }
+    }
+
+    for _, o := range defaultsOptions {
+        q.Del(o)
+    }
+    dsn.RawQuery = q.Encode()
+    applyConfig(dsn, cfg)
+    return origins, nil
+}
+
+// mergeTracked is mergeConfigs that also records origin for every key it
+// fills in.
+func mergeTracked(target *iniConfig, source iniConfig, origin string, origins map[string]string) error {
+    before := *target
+    if err := mergeConfigs(target, source); err != nil {
+        return err
+    }
+    b := reflect.ValueOf(before)
+    t := reflect.ValueOf(*target)
+    for i := 0; i < t.NumField(); i++ {
+        if b.Field(i).IsZero() && !t.Field(i).IsZero() {
+            origins[b.Type().Field(i).Tag.Get("ini")] = origin
+        }
+    }
+    return nil
+}
+
+// setConfigKey sets the iniConfig field for an option file key.
+func setConfigKey(cfg *iniConfig, key, value string) {
+    v := reflect.ValueOf(cfg).Elem()
+    for i := 0; i < v.NumField(); i++ {
+        if v.Type().Field(i).Tag.Get("ini") == key {
+            v.Field(i).SetString(value)
+            return
+        }
+    }
+}
+
+// readPasswordFile reads a password from the first line of a file that
+// only its owner can access.
+func readPasswordFile(name string) (string, error) {
+    fi, err := os.Stat(name)
+    if err != nil {
+        return "", fmt.Errorf("password file: %w", err)
+    }
+    if fi.Mode().Perm()&0o077 != 0 {
+        return "", fmt.Errorf("password file: %s is accessible by others (mode %04o, expected 0600)",
+            name, fi.Mode().Perm())
+    }
+    data, err := os.ReadFile(name)
+    if err != nil {
+        return "", fmt.Errorf("password file: %w", err)
+    }
+    pass, _, _ := strings.Cut(string(data), "\n")
+    return strings.TrimSuffix(pass, "\r"), nil
+}
+
+// optionSource is a piece of an option file, split at include directives.
+type optionSource struct {
+    name string
+    data []byte
+}
+
+// unreadableError is returned by readOptionFile when the file itself
+// cannot be opened or read, as opposed to a problem with its content or
+// with a file it includes.
+type unreadableError struct {
+    err error
+}
+
+func (e *unreadableError) Error() string { return e.err.Error() }
+func (e *unreadableError) Unwrap() error { return e.err }
+
+// mergeOptionFiles fills cfg from option files. Later files override
+// earlier ones and, within a file, later groups override earlier groups, so
+// the sources are walked backwards and mergeTracked only fills what a
+// later source left unset. Like the mysql client, files that cannot be
+// read are skipped unless they are required; missing ones silently, others
+// with a warning.
+func mergeOptionFiles(cfg *iniConfig, files []optionFile, groups []string, origins map[string]string) error {
+    var sources []optionSource
+    for _, file := range files {
+        srcs, err := readOptionFile(file.path, 0)
+        var unreadable *unreadableError
+        if errors.As(err, &unreadable) && !file.required {
+            if !errors.Is(err, fs.ErrNotExist) {
+                fmt.Fprintf(os.Stderr, "warning: skipping option file: %v\n", err)
+            }
+            continue
+        }
+        if err != nil {
+            return fmt.Errorf("defaults file: %w", err)
+        }
+        sources = append(sources, srcs...)
+    }
+
+    for i := len(sources) - 1; i >= 0; i-- {
+        f, err := ini.LoadSources(
+            ini.LoadOptions{
+                AllowBooleanKeys: true,
+                IgnoreContinuation: true,
+                IgnoreInlineComment: true,
+            },
+            sources[i].data,
+        )
+        if err != nil {
+            return fmt.Errorf("defaults file: %s: %w", sources[i].name, err)
+        }
+        for j := len(groups) - 1; j >= 0; j-- {
+            // silently ignores non-existent group name
+            s, err := f.GetSection(groups[j])
+            if err != nil {
+                continue
+            }
+            var groupCfg iniConfig
+            if err := s.MapTo(&groupCfg); err != nil {
+                return err
+            }
+            foldLegacySSL(&groupCfg)
+            origin := fmt.Sprintf("%s [%s]", sources[i].name, groups[j])
+            if err := mergeTracked(cfg, groupCfg, origin, origins); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+// foldLegacySSL turns the ssl switch of older clients into ssl-mode,
+// unless the same group sets ssl-mode. A bare ssl or ssl=1 means REQUIRED,
+// like the ssl DSN option; ssl=0, skip-ssl and disable-ssl mean DISABLED.
+func foldLegacySSL(cfg *iniConfig) {
+    on, isSet := optionBool(cfg.SSL)
+    if off, ok := optionBool(cfg.SkipSSL); ok && off {
+        on, isSet = false, true
+    }
+    if off, ok := optionBool(cfg.DisableSSL); ok && off {
+        on, isSet = false, true
+    }
+    if cfg.SSLMode == "" && isSet {
+        cfg.SSLMode = SSLModeDisabled
+        if on {
+            cfg.SSLMode = SSLModeRequired
+        }
+    }
+    cfg.SSL, cfg.SkipSSL, cfg.DisableSSL = "", "", ""
+}
+
+// optionBool reads a boolean option value the way the mysql client does.
+// A key given without a value reads as true.
+func optionBool(s string) (value, ok bool) {
+    switch strings.ToLower(strings.TrimSpace(s)) {
+    case "1", "true", "on":
+        return true, true
+    case "0", "false", "off":
+        return false, true
+    }
+    return false, false
+}
+
+// readOptionFile returns the contents of an option file as ini sources,
+// with !include and !includedir expanded in place. Text following a
+// directive is re-opened under the group it appeared in. Option names are
+// normalised so that ssl_ca and ssl-ca are the same key.
+func readOptionFile(name string, depth int) ([]optionSource, error) {
+    if depth > maxIncludeDepth {
+        return nil, fmt.Errorf("%s: includes nested too deeply", name)
+    }
+    data, err := os.ReadFile(name)
+    if err != nil {
+        return nil, &unreadableError{err}
+    }
+
+    var (
+        sources []optionSource
+        chunk   bytes.Buffer
+        group   string
+    )
+    flush := func() {
+        if chunk.Len() > 0 {
+            data := append([]byte(nil), chunk.Bytes()...)
+            sources = append(sources, optionSource{name, data})
+            chunk.Reset()
+        }
+    }
+
+    sc := bufio.NewScanner(bytes.NewReader(data))
+    for sc.Scan() {
+        line := sc.Text()
+        trimmed := strings.TrimSpace(line)
+        switch {
+        case strings.HasPrefix(trimmed, "["):
+            group = trimmed
+        case strings.HasPrefix(trimmed, "!includedir"):
+            dir := resolveInclude(name, strings.TrimSpace(trimmed[len("!includedir"):]))
+            flush()
+            included, err := readOptionDir(dir, depth+1)
+            if err != nil {
+                return nil, err
+            }
+            sources = append(sources, included...)
+            if group != "" {
+                chunk.WriteString(group + "\n")
+            }
+            continue
+        case strings.HasPrefix(trimmed, "!include"):
+            file := resolveInclude(name, strings.TrimSpace(trimmed[len("!include"):]))
+            flush()
+            included, err := readOptionFile(file, depth+1)
+            if err != nil {
+                // An explicit !include must be readable, even in a
+                // file that may be skipped.
+                var unreadable *unreadableError
+                if errors.As(err, &unreadable) {
+                    return nil, fmt.Errorf("%s: !include: %w", name, unreadable.err)
+                }
+                return nil, err
+            }
+            sources = append(sources, included...)
+            if group != "" {
+                chunk.WriteString(group + "\n")
+            }
+            continue
+        case trimmed != "" && trimmed[0] != '#' && trimmed[0] != ';':
+            line = normaliseOptionName(line)
+        }
+        chunk.WriteString(line)
+        chunk.WriteByte('\n')
+    }
+    if err := sc.Err(); err != nil {
+        return nil, err
+    }
+    flush()
+    return sources, nil
+}
+
+// readOptionDir reads every *.cnf file in dir in name order. A directory
+// or file that cannot be read is skipped with a warning, a missing
+// directory silently.
+func readOptionDir(dir string, depth int) ([]optionSource, error) {
+    entries, err := os.ReadDir(dir)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "warning: skipping option directory: %v\n", err)
+        return nil, nil
+    }
+    var names []string
+    for _, e := range entries {
+        if !e.IsDir() && strings.HasSuffix(e.Name(), ".cnf") {
+            names = append(names, filepath.Join(dir, e.Name()))
+        }
+    }
+    sort.Strings(names)
+
+    var sources []optionSource
+    for _, n := range names {
+        s, err := readOptionFile(n, depth)
+        var unreadable *unreadableError
+        if errors.As(err, &unreadable) {
+            fmt.Fprintf(os.Stderr, "warning: skipping option file: %v\n", err)
+            continue
+        }
+        if err != nil {
+            return nil, err
+        }
+        sources = append(sources, s...)
+    }
+    return sources, nil
+}
+
+// resolveInclude interprets a relative include path against the including
+// file's directory.
+func resolveInclude(from, path string) string {
+    if filepath.IsAbs(path) {
+        return path
+    }
+    return filepath.Join(filepath.Dir(from), path)
+}
+
+func normaliseOptionName(line string) string {
+    end := strings.IndexByte(line, '=')
+    if end < 0 {
+        end = len(line)
+    }
+    return strings.ReplaceAll(line[:end], "_", "-") + line[end:]
+}
+
+// Setting is one effective connection setting and where it came from.
+type Setting struct {
+    Name   string
+    Value  string
+    Origin string
+}
+
+// Settings lists the effective connection settings by option file key,
+// with the password redacted.
+func (m *MySQL) Settings() []Setting {
+    cfg := urlToConfig(m.dsn)
+    v := reflect.ValueOf(cfg)
+    var out []Setting
+    for i := 0; i < v.NumField(); i++ {
+        key := v.Type().Field(i).Tag.Get("ini")
+        value := v.Field(i).String()
+        origin := m.origins[key]
+        switch {
+        case key == "port" && value == "" && m.Socket() == "":
+            value, origin = strconv.Itoa(m.Port()), "default"
+        case value == "":
+            continue
+        case key == "password":
+            value = "xxxxx"
+        }
+        if origin == "" {
+            origin = "DSN"
+        }
+        out = append(out, Setting{key, value, origin})
+    }
+    return out
+}
@@ -0,0 +1,114 @@
+package dsn
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+    t.Helper()
+    if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestMergeOptionFilesSkipsUnreadable(t *testing.T) {
+    dir := t.TempDir()
+    good := filepath.Join(dir, "good.cnf")
+    writeFile(t, good, "[client]\nuser = bob\n")
+    // A directory where a file is expected cannot be read.
+    notFile := filepath.Join(dir, "my.cnf")
+    if err := os.Mkdir(notFile, 0o700); err != nil {
+        t.Fatal(err)
+    }
+    confDir := filepath.Join(dir, "conf.d")
+    if err := os.Mkdir(confDir, 0o700); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Mkdir(filepath.Join(confDir, "broken.cnf"), 0o700); err != nil {
+        t.Fatal(err)
+    }
+    withDir := filepath.Join(dir, "withdir.cnf")
+    writeFile(t, withDir, "[client]\n!includedir "+confDir+"\nhost = db1\n")
+
+    var cfg iniConfig
+    files := []optionFile{
+        {path: notFile},
+        {path: filepath.Join(dir, "missing.cnf")},
+        {path: withDir},
+        {path: good},
+    }
+    if err := mergeOptionFiles(&cfg, files, defaultGroups, map[string]string{}); err != nil {
+        t.Fatal(err)
+    }
+    if cfg.User != "bob" || cfg.Host != "db1" {
+        t.Errorf("got user %q host %q, want bob and db1", cfg.User, cfg.Host)
+    }
+}
+
+func TestMergeOptionFilesRequired(t *testing.T) {
+    dir := t.TempDir()
+    missing := filepath.Join(dir, "missing.cnf")
+    including := filepath.Join(dir, "including.cnf")
+    writeFile(t, including, "[client]\n!include "+missing+"\n")
+
+    for _, files := range [][]optionFile{
+        {{path: missing, required: true}},
+        {{path: dir, required: true}},
+        // An explicit !include must be readable even in an optional file.
+        {{path: including}},
+    } {
+        var cfg iniConfig
+        if err := mergeOptionFiles(&cfg, files, defaultGroups, map[string]string{}); err == nil {
+            t.Errorf("%s: no error", files[0].path)
+        }
+    }
+}
+
+func TestMergeOptionFilesLegacySSL(t *testing.T) {
+    tests := []struct {
+        group string
+        want  string
+    }{
+        {"ssl", SSLModeRequired},
+        {"ssl = 1", SSLModeRequired},
+        {"ssl = ON", SSLModeRequired},
+        {"ssl = 0", SSLModeDisabled},
+        {"skip-ssl", SSLModeDisabled},
+        {"skip_ssl", SSLModeDisabled},
+        {"disable-ssl", SSLModeDisabled},
+        {"ssl\nssl-mode = VERIFY_IDENTITY", "VERIFY_IDENTITY"},
+        {"ssl = maybe", ""},
+        {"", ""},
+    }
+    for _, tt := range tests {
+        path := filepath.Join(t.TempDir(), "my.cnf")
+        writeFile(t, path, "[client]\nuser = bob\n"+tt.group+"\n")
+        var cfg iniConfig
+        if err := mergeOptionFiles(&cfg, []optionFile{{path: path}}, defaultGroups, map[string]string{}); err != nil {
+            t.Errorf("%q: %v", tt.group, err)
+            continue
+        }
+        if cfg.SSLMode != tt.want {
+            t.Errorf("%q: ssl-mode %q, want %q", tt.group, cfg.SSLMode, tt.want)
+        }
+    }
+}
+
+func TestMergeOptionFilesLegacySSLOverride(t *testing.T) {
+    // ~/.my.cnf is read last and overrides a global ssl-mode.
+    dir := t.TempDir()
+    global := filepath.Join(dir, "global.cnf")
+    writeFile(t, global, "[client]\nssl-mode = REQUIRED\n")
+    home := filepath.Join(dir, "home.cnf")
+    writeFile(t, home, "[client]\nskip-ssl\n")
+    var cfg iniConfig
+    files := []optionFile{{path: global}, {path: home}}
+    if err := mergeOptionFiles(&cfg, files, defaultGroups, map[string]string{}); err != nil {
+        t.Fatal(err)
+    }
+    if cfg.SSLMode != SSLModeDisabled {
+        t.Errorf("ssl-mode %q, want %s", cfg.SSLMode, SSLModeDisabled)
+    }
+}
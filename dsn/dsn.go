@@ -3,20 +3,24 @@ package dsn
 import (
     "errors"
     "fmt"
+    "net"
     "net/url"
+    "os"
     "os/user"
     "reflect"
     "strconv"
+    "strings"
+    "time"
     "unsafe"
 
     "github.com/alecthomas/kong"
-    "gopkg.in/ini.v1"
     "golang.org/x/term"
     "github.com/go-sql-driver/mysql"
 )
 
 const (
     defaultPrompt string = "Enter password"
+    unixScheme    string = "mysql+unix"
 )
 
 var (
@@ -29,7 +33,8 @@ var (
 var MySQLMapper      = defaultMapper((*MySQL)(nil).Scheme())
 
 type MySQL struct {
-    dsn *url.URL
+    dsn     *url.URL
+    origins map[string]string // option file key -> where the value came from
 }
 
 func (m *MySQL) Scheme() string {
@@ -42,8 +47,8 @@ func (m *MySQL) URL() string {
 
 func (m *MySQL) DSN() string {
     cfg := mysql.NewConfig()
-    cfg.Addr = m.dsn.Host
-    cfg.Net = "tcp"
+    cfg.Addr = m.Address()
+    cfg.Net = m.Network()
     cfg.User = m.dsn.User.Username()
     cfg.Passwd, _ = m.dsn.User.Password()
     cfg.DBName = m.dsn.Path[1:]
@@ -91,6 +96,63 @@ func (m *MySQL) Port() int {
     return p
 }
 
+// ConnectTimeout returns the connectTimeout option, or def when it is not
+// set. Like the mysql client's connect-timeout, a bare number is seconds.
+func (m *MySQL) ConnectTimeout(def time.Duration) (time.Duration, error) {
+    return durationOption(m.Options(), "connectTimeout", def)
+}
+
+// ReadTimeout returns the readTimeout option, or 0 (no timeout).
+func (m *MySQL) ReadTimeout() (time.Duration, error) {
+    return durationOption(m.Options(), "readTimeout", 0)
+}
+
+// WriteTimeout returns the writeTimeout option, or 0 (no timeout).
+func (m *MySQL) WriteTimeout() (time.Duration, error) {
+    return durationOption(m.Options(), "writeTimeout", 0)
+}
+
+func durationOption(q url.Values, name string, def time.Duration) (time.Duration, error) {
+    s := q.Get(name)
+    if s == "" {
+        return def, nil
+    }
+    if n, err := strconv.Atoi(s); err == nil {
+        return time.Duration(n) * time.Second, nil
+    }
+    d, err := time.ParseDuration(s)
+    if err != nil || d < 0 {
+        return 0, fmt.Errorf("%s: invalid duration %q", name, s)
+    }
+    return d, nil
+}
+
+// Socket returns the Unix socket path to connect through, or "" for TCP.
+// As with the mysql client, a socket is only used when the host is empty or
+// "localhost".
+func (m *MySQL) Socket() string {
+    if h := m.Host(); h != "" && h != "localhost" {
+        return ""
+    }
+    return m.Options().Get("socket")
+}
+
+// Network returns "unix" or "tcp".
+func (m *MySQL) Network() string {
+    if m.Socket() != "" {
+        return "unix"
+    }
+    return "tcp"
+}
+
+// Address returns the socket path or host:port to dial.
+func (m *MySQL) Address() string {
+    if s := m.Socket(); s != "" {
+        return s
+    }
+    return net.JoinHostPort(m.Host(), strconv.Itoa(m.Port()))
+}
+
 func (m *MySQL) AskPass() error {
     return m.AskPassWithPrompt(defaultPrompt)
 }
@@ -102,15 +164,36 @@ func (m *MySQL) AskPassWithPrompt(prompt string) error {
     }
     name := m.dsn.User.Username()
     m.dsn.User = url.UserPassword(name, pass)
+    if m.origins == nil {
+        m.origins = make(map[string]string)
+    }
+    m.origins["password"] = "password prompt"
     return nil
 }
 
 type iniConfig struct {
-    Host     string `ini:"host"`
-    Port     string `ini:"port"`
-    User     string `ini:"user"`
-    Password string `ini:"password"`
-    Database string `ini:"database"`
+    Host           string `ini:"host"`
+    Port           string `ini:"port"`
+    User           string `ini:"user"`
+    Password       string `ini:"password"`
+    Database       string `ini:"database"`
+    // fields below are carried as DSN options named by the opt tag
+    Socket         string `ini:"socket"                opt:"socket"`
+    SSLMode        string `ini:"ssl-mode"              opt:"sslMode"`
+    SSLCA          string `ini:"ssl-ca"                opt:"sslCa"`
+    SSLCert        string `ini:"ssl-cert"              opt:"sslCert"`
+    SSLKey         string `ini:"ssl-key"               opt:"sslKey"`
+    SSLCipher      string `ini:"ssl-cipher"            opt:"sslCipher"`
+    TLSVersion     string `ini:"tls-version"           opt:"tlsVersion"`
+    Charset        string `ini:"default-character-set" opt:"charset"`
+    InitCommand    string `ini:"init-command"          opt:"initCommand"`
+    ConnectTimeout string `ini:"connect-timeout"       opt:"connectTimeout"`
+    ReadTimeout    string `ini:"read-timeout"          opt:"readTimeout"`
+    WriteTimeout   string `ini:"write-timeout"         opt:"writeTimeout"`
+    // switches of older clients, folded into SSLMode by foldLegacySSL
+    SSL            string `ini:"ssl"`
+    SkipSSL        string `ini:"skip-ssl"`
+    DisableSSL     string `ini:"disable-ssl"`
 }
 
 func defaultMapper(scheme string) kong.MapperFunc {
@@ -120,33 +203,41 @@ func defaultMapper(scheme string) kong.MapperFunc {
         if err != nil {
             return err
         }
-        dsn, err := stringToUrl(s)
+        dsn, origins, err := stringToUrl(s)
         if err != nil {
             return err
         }
         if dsn.Scheme != scheme {
             return ErrInvalidScheme
         }
-        if dsn.Hostname() == "" {
+        if dsn.Hostname() == "" && dsn.Query().Get("socket") == "" {
             return ErrInvalidHostname
         }
-        field := target.Elem().FieldByName("dsn") // 'dsn' MUST exist
-        wr := reflect.NewAt(
-            field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
-        wr.Set(reflect.ValueOf(dsn))
+        setField(target, "dsn", dsn) // 'dsn' MUST exist
+        setField(target, "origins", origins)
         return nil
     }
 }
 
+func setField(target reflect.Value, name string, value interface{}) {
+    field := target.Elem().FieldByName(name)
+    wr := reflect.NewAt(
+        field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+    wr.Set(reflect.ValueOf(value))
+}
+
 func Parse(s string) (MySQL, error) {
-    dsn, err := stringToUrl(s)
-    return MySQL{dsn}, err
+    dsn, origins, err := stringToUrl(s)
+    return MySQL{dsn, origins}, err
 }
 
-func stringToUrl(s string) (*url.URL, error) {
+func stringToUrl(s string) (*url.URL, map[string]string, error) {
     dsn, err := url.Parse(s)
     if err != nil {
-        return nil, err
+        return nil, nil, err
+    }
+    if dsn.Scheme == unixScheme {
+        unixSchemeToSocket(dsn)
     }
     // sanitize path (i.e. database name)
     if len(dsn.Path) == 0 || dsn.Path[0] != '/' {
@@ -154,47 +245,64 @@ func stringToUrl(s string) (*url.URL, error) {
         dsn.RawPath = ""
     }
 
-    q := dsn.Query()
-    if _, exists := q["defaultsFile"]; exists {
-        cfg := urlToConfig(dsn)
-
-        group := "client"
-        if _, exists := q["defaultsGroup"]; exists {
-            group = q["defaultsGroup"][0]
-        }
-        cfg2, err := loadConfigFromIniFile(q["defaultsFile"][0], group)
-        if err != nil {
-            return nil, err
-        }
-        if err := mergeConfigs(&cfg, cfg2); err != nil {
-            return nil, err
-        }
-
-        dsn.User = url.UserPassword(cfg.User, cfg.Password)
-        dsn.Host = cfg.Host
-        if cfg.Port != "" {
-            dsn.Host += ":" + cfg.Port
-        }
-        dsn.Path = "/" + cfg.Database
-
-        q.Del("defaultsFile")
-        q.Del("defaultsGroup")
-        dsn.RawQuery = q.Encode()
+    origins, err := applyDefaults(dsn)
+    if err != nil {
+        return nil, nil, err
     }
 
     if dsn.User.Username() == "" {
         pass, _ := dsn.User.Password()
         u, err := user.Current()
         if err != nil {
-            return nil, err
+            return nil, nil, err
         }
         dsn.User = url.UserPassword(u.Username, pass)
+        origins["user"] = "current OS user"
+    }
+    return dsn, origins, nil
+}
+
+// unixSchemeToSocket rewrites mysql+unix://user@/path/to/mysqld.sock/db
+// into the equivalent mysql://user@/db?socket=/path/to/mysqld.sock. The
+// socket path ends with the first path element named *.sock. Without one
+// it ends with the first element that is a socket on this host, and
+// failing that the whole path is the socket.
+func unixSchemeToSocket(dsn *url.URL) {
+    socket, db := dsn.Path, ""
+    parts := strings.Split(dsn.Path, "/")
+    if i := socketElement(parts); i >= 0 {
+        socket = strings.Join(parts[:i+1], "/")
+        db = strings.Join(parts[i+1:], "/")
+    }
+    q := dsn.Query()
+    if socket != "" {
+        q.Set("socket", socket)
+    }
+    dsn.Scheme = (*MySQL)(nil).Scheme()
+    dsn.Path = "/" + db
+    dsn.RawPath = ""
+    dsn.RawQuery = q.Encode()
+}
+
+// socketElement returns the index of the path element that ends the
+// socket path, or -1.
+func socketElement(parts []string) int {
+    for i, p := range parts {
+        if strings.HasSuffix(p, ".sock") {
+            return i
+        }
+    }
+    for i := range parts {
+        path := strings.Join(parts[:i+1], "/")
+        if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+            return i
+        }
     }
-    return dsn, nil
+    return -1
 }
 
 func urlToConfig(dsn *url.URL) iniConfig {
-    return iniConfig{
+    cfg := iniConfig{
         Host:     dsn.Hostname(),
         Port:     dsn.Port(),
         User:     dsn.User.Username(),
@@ -210,28 +318,53 @@ func urlToConfig(dsn *url.URL) iniConfig {
             return ""
         }(),
     }
+    optionsToConfig(dsn.Query(), &cfg)
+    return cfg
 }
 
-func loadConfigFromIniFile(filename, group string) (iniConfig, error) {
-    f, err := ini.LoadSources(
-        ini.LoadOptions{
-            AllowBooleanKeys: true,
-            IgnoreContinuation: true,
-            IgnoreInlineComment: true,
-        },
-        filename,
-    )
-    if err != nil {
-        return iniConfig{}, fmt.Errorf("defaults file: %w", err)
+// optionsToConfig copies DSN options into the iniConfig fields tagged
+// with a matching opt name.
+func optionsToConfig(q url.Values, cfg *iniConfig) {
+    v := reflect.ValueOf(cfg).Elem()
+    for i := 0; i < v.NumField(); i++ {
+        if opt := v.Type().Field(i).Tag.Get("opt"); opt != "" {
+            v.Field(i).SetString(q.Get(opt))
+        }
     }
-    var cfg iniConfig
-    // silently ignores non-existent group name
-    if s := f.Section(group); s != nil {
-        if err := s.MapTo(&cfg); err != nil {
-            return iniConfig{}, err
+}
+
+// configToOptions is the reverse of optionsToConfig. Empty fields are left
+// out.
+func configToOptions(cfg iniConfig, q url.Values) {
+    v := reflect.ValueOf(cfg)
+    for i := 0; i < v.NumField(); i++ {
+        opt := v.Type().Field(i).Tag.Get("opt")
+        if opt != "" && v.Field(i).String() != "" {
+            q.Set(opt, v.Field(i).String())
         }
     }
-    return cfg, nil
+}
+
+// applyConfig writes cfg back into the URL, replacing whatever was there.
+func applyConfig(dsn *url.URL, cfg iniConfig) {
+    if cfg.Password != "" {
+        dsn.User = url.UserPassword(cfg.User, cfg.Password)
+    } else {
+        dsn.User = url.User(cfg.User)
+    }
+    // An IPv6 address needs brackets in the URL, with or without a port.
+    switch {
+    case cfg.Port != "":
+        dsn.Host = net.JoinHostPort(cfg.Host, cfg.Port)
+    case strings.Contains(cfg.Host, ":"):
+        dsn.Host = "[" + cfg.Host + "]"
+    default:
+        dsn.Host = cfg.Host
+    }
+    dsn.Path = "/" + cfg.Database
+    q := dsn.Query()
+    configToOptions(cfg, q)
+    dsn.RawQuery = q.Encode()
 }
 
 func mergeConfigs(target *iniConfig, source iniConfig) error {
@@ -0,0 +1,47 @@
+package dsn
+
+import (
+    "net"
+    "path/filepath"
+    "testing"
+)
+
+func TestParseUnixScheme(t *testing.T) {
+    dir := t.TempDir()
+    // A socket whose name does not end in .sock.
+    socket := filepath.Join(dir, "mysqld")
+    l, err := net.Listen("unix", socket)
+    if err != nil {
+        t.Skipf("cannot create a unix socket: %v", err)
+    }
+    defer l.Close()
+
+    tests := []struct {
+        dsn    string
+        socket string
+        db     string
+    }{
+        {"mysql+unix://bob@/var/run/mysqld/mysqld.sock", "/var/run/mysqld/mysqld.sock", ""},
+        {"mysql+unix://bob@/var/run/mysqld/mysqld.sock/shop", "/var/run/mysqld/mysqld.sock", "shop"},
+        {"mysql+unix://bob@" + socket, socket, ""},
+        {"mysql+unix://bob@" + socket + "/shop", socket, "shop"},
+        // Nothing marks where the socket path ends: all of it is.
+        {"mysql+unix://bob@" + dir + "/nosuch/shop", dir + "/nosuch/shop", ""},
+    }
+    for _, tt := range tests {
+        m, err := Parse(tt.dsn + "?noDefaults")
+        if err != nil {
+            t.Errorf("%s: %v", tt.dsn, err)
+            continue
+        }
+        if got := m.Socket(); got != tt.socket {
+            t.Errorf("%s: socket %q, want %q", tt.dsn, got, tt.socket)
+        }
+        if got := m.Db(); got != tt.db {
+            t.Errorf("%s: database %q, want %q", tt.dsn, got, tt.db)
+        }
+        if got := m.Scheme(); got != "mysql" {
+            t.Errorf("%s: scheme %q, want mysql", tt.dsn, got)
+        }
+    }
+}
@@ -0,0 +1,114 @@
+package dsn
+
+import (
+    "bytes"
+    "crypto/aes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+
+    "gopkg.in/ini.v1"
+)
+
+// .mylogin.cnf layout: 4 unused bytes, a 20-byte key, then a sequence of
+// records, each a 4-byte little-endian length followed by that many bytes
+// of AES-128-ECB ciphertext of one line of ini text.
+const (
+    loginUnusedLen = 4
+    loginKeyLen    = 20
+)
+
+var ErrInvalidLoginFile = errors.New("invalid login path file")
+
+// loginPathFile returns the location of .mylogin.cnf. MYSQL_TEST_LOGIN_FILE
+// overrides it, as for the mysql client.
+func loginPathFile() (string, error) {
+    if f := os.Getenv("MYSQL_TEST_LOGIN_FILE"); f != "" {
+        return f, nil
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(home, ".mylogin.cnf"), nil
+}
+
+// loadLoginPath reads the named login path from .mylogin.cnf. Only the
+// values mysql_config_editor can store are taken.
+func loadLoginPath(name string) (iniConfig, error) {
+    path, err := loginPathFile()
+    if err != nil {
+        return iniConfig{}, fmt.Errorf("login path: %w", err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return iniConfig{}, fmt.Errorf("login path: %w", err)
+    }
+    plain, err := decryptLoginFile(data)
+    if err != nil {
+        return iniConfig{}, fmt.Errorf("login path: %s: %w", path, err)
+    }
+
+    f, err := ini.LoadSources(ini.LoadOptions{AllowBooleanKeys: true}, plain)
+    if err != nil {
+        return iniConfig{}, fmt.Errorf("login path: %w", err)
+    }
+    s, err := f.GetSection(name)
+    if err != nil {
+        return iniConfig{}, fmt.Errorf("login path: %q not found in %s", name, path)
+    }
+    var all iniConfig
+    if err := s.MapTo(&all); err != nil {
+        return iniConfig{}, err
+    }
+    return iniConfig{
+        Host:     all.Host,
+        Port:     all.Port,
+        User:     all.User,
+        Password: all.Password,
+        Socket:   all.Socket,
+    }, nil
+}
+
+func decryptLoginFile(data []byte) ([]byte, error) {
+    if len(data) < loginUnusedLen+loginKeyLen {
+        return nil, ErrInvalidLoginFile
+    }
+    // the 20-byte key is folded into a 16-byte AES key by XOR
+    var key [16]byte
+    for i, b := range data[loginUnusedLen : loginUnusedLen+loginKeyLen] {
+        key[i%len(key)] ^= b
+    }
+    block, err := aes.NewCipher(key[:])
+    if err != nil {
+        return nil, err
+    }
+
+    var out bytes.Buffer
+    rest := data[loginUnusedLen+loginKeyLen:]
+    for len(rest) > 0 {
+        if len(rest) < 4 {
+            return nil, ErrInvalidLoginFile
+        }
+        n := int(binary.LittleEndian.Uint32(rest))
+        rest = rest[4:]
+        if n == 0 || n > len(rest) || n%aes.BlockSize != 0 {
+            return nil, ErrInvalidLoginFile
+        }
+        line := make([]byte, n)
+        for i := 0; i < n; i += aes.BlockSize {
+            block.Decrypt(line[i:i+aes.BlockSize], rest[i:i+aes.BlockSize])
+        }
+        rest = rest[n:]
+
+        // strip PKCS#7 padding
+        pad := int(line[n-1])
+        if pad == 0 || pad > aes.BlockSize {
+            return nil, ErrInvalidLoginFile
+        }
+        out.Write(line[:n-pad])
+    }
+    return out.Bytes(), nil
+}
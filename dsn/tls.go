@@ -0,0 +1,173 @@
+package dsn
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// SSL modes as understood by the mysql client's --ssl-mode.
+const (
+    SSLModeDisabled       = "DISABLED"
+    SSLModePreferred      = "PREFERRED"
+    SSLModeRequired       = "REQUIRED"
+    SSLModeVerifyCA       = "VERIFY_CA"
+    SSLModeVerifyIdentity = "VERIFY_IDENTITY"
+)
+
+var ErrInvalidSSLMode = errors.New(
+    "invalid ssl mode (expected DISABLED, PREFERRED, REQUIRED, VERIFY_CA or VERIFY_IDENTITY)")
+
+var tlsVersions = map[string]uint16{
+    "TLSV1":   tls.VersionTLS10,
+    "TLSV1.1": tls.VersionTLS11,
+    "TLSV1.2": tls.VersionTLS12,
+    "TLSV1.3": tls.VersionTLS13,
+}
+
+// OpenSSL names of the TLS 1.2 cipher suites Go implements, as accepted by
+// the mysql client's --ssl-cipher. Go names are accepted as well.
+var opensslCiphers = map[string]uint16{
+    "ECDHE-ECDSA-AES128-GCM-SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+    "ECDHE-RSA-AES128-GCM-SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+    "ECDHE-ECDSA-AES256-GCM-SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+    "ECDHE-RSA-AES256-GCM-SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+    "ECDHE-ECDSA-CHACHA20-POLY1305": tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+    "ECDHE-RSA-CHACHA20-POLY1305":   tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+    "ECDHE-ECDSA-AES128-SHA":        tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+    "ECDHE-RSA-AES128-SHA":          tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+    "ECDHE-ECDSA-AES256-SHA":        tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+    "ECDHE-RSA-AES256-SHA":          tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+    "AES128-GCM-SHA256":             tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+    "AES256-GCM-SHA384":             tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+    "AES128-SHA":                    tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+    "AES256-SHA":                    tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+}
+
+// SSLMode returns the effective ssl mode. Without an explicit sslMode, the
+// bare ssl option means REQUIRED and a CA certificate means VERIFY_CA, like
+// the mysql client. Otherwise TLS is disabled.
+func (m *MySQL) SSLMode() string {
+    q := m.Options()
+    if mode := q.Get("sslMode"); mode != "" {
+        return strings.ToUpper(mode)
+    }
+    if q.Get("sslCa") != "" {
+        return SSLModeVerifyCA
+    }
+    if _, ok := q["ssl"]; ok || q.Get("sslCert") != "" {
+        return SSLModeRequired
+    }
+    return SSLModeDisabled
+}
+
+// TLSConfig builds the TLS configuration described by the ssl* and
+// tlsVersion options. It returns nil when TLS is disabled, and with
+// PREFERRED over a socket, which like the mysql client only uses TLS over
+// TCP. With PREFERRED the caller connects without TLS when the server does
+// not offer it.
+func (m *MySQL) TLSConfig() (*tls.Config, error) {
+    mode := m.SSLMode()
+    if mode == SSLModeDisabled || mode == SSLModePreferred && m.Socket() != "" {
+        return nil, nil
+    }
+    q := m.Options()
+    cfg := &tls.Config{ServerName: m.Host()}
+
+    if ca := q.Get("sslCa"); ca != "" {
+        pem, err := os.ReadFile(ca)
+        if err != nil {
+            return nil, fmt.Errorf("ssl ca: %w", err)
+        }
+        pool := x509.NewCertPool()
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("ssl ca: no certificates found in %s", ca)
+        }
+        cfg.RootCAs = pool
+    }
+
+    cert, key := q.Get("sslCert"), q.Get("sslKey")
+    if (cert == "") != (key == "") {
+        return nil, errors.New("ssl cert and ssl key must be given together")
+    }
+    if cert != "" {
+        pair, err := tls.LoadX509KeyPair(cert, key)
+        if err != nil {
+            return nil, fmt.Errorf("ssl cert: %w", err)
+        }
+        cfg.Certificates = []tls.Certificate{pair}
+    }
+
+    switch mode {
+    case SSLModePreferred, SSLModeRequired:
+        cfg.InsecureSkipVerify = true
+    case SSLModeVerifyCA:
+        // Verify the chain but not the host name.
+        cfg.InsecureSkipVerify = true
+        cfg.VerifyConnection = verifyChain(cfg.RootCAs)
+    case SSLModeVerifyIdentity:
+        if m.Socket() != "" {
+            return nil, errors.New("ssl mode VERIFY_IDENTITY needs a host name, not a socket")
+        }
+    default:
+        return nil, ErrInvalidSSLMode
+    }
+
+    if v := q.Get("tlsVersion"); v != "" {
+        for _, name := range strings.Split(v, ",") {
+            ver, ok := tlsVersions[strings.ToUpper(strings.TrimSpace(name))]
+            if !ok {
+                return nil, fmt.Errorf("tls version: unknown version %q", name)
+            }
+            if cfg.MinVersion == 0 || ver < cfg.MinVersion {
+                cfg.MinVersion = ver
+            }
+            if ver > cfg.MaxVersion {
+                cfg.MaxVersion = ver
+            }
+        }
+    }
+
+    if c := q.Get("sslCipher"); c != "" {
+        for _, name := range strings.Split(c, ":") {
+            id, err := cipherSuiteID(strings.TrimSpace(name))
+            if err != nil {
+                return nil, err
+            }
+            cfg.CipherSuites = append(cfg.CipherSuites, id)
+        }
+    }
+    return cfg, nil
+}
+
+func verifyChain(roots *x509.CertPool) func(tls.ConnectionState) error {
+    return func(cs tls.ConnectionState) error {
+        if len(cs.PeerCertificates) == 0 {
+            return errors.New("server sent no certificate")
+        }
+        opts := x509.VerifyOptions{
+            Roots:         roots,
+            Intermediates: x509.NewCertPool(),
+        }
+        for _, c := range cs.PeerCertificates[1:] {
+            opts.Intermediates.AddCert(c)
+        }
+        _, err := cs.PeerCertificates[0].Verify(opts)
+        return err
+    }
+}
+
+func cipherSuiteID(name string) (uint16, error) {
+    if id, ok := opensslCiphers[strings.ToUpper(name)]; ok {
+        return id, nil
+    }
+    for _, cs := range tls.CipherSuites() {
+        if strings.EqualFold(cs.Name, name) {
+            return cs.ID, nil
+        }
+    }
+    return 0, fmt.Errorf("ssl cipher: unknown or unsupported cipher %q", name)
+}
@@ -0,0 +1,624 @@
+// Package editor reads multi-line queries from a terminal. It supports
+// cursor movement across lines, word-wise movement and deletion, bracketed
+// paste and a persistent, searchable history.
+package editor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned by ReadQuery when the user presses Ctrl+C.
+var ErrInterrupted = errors.New("interrupted")
+
+const (
+	bracketedPasteOn  = "\x1b[?2004h"
+	bracketedPasteOff = "\x1b[?2004l"
+	pasteEnd          = "\x1b[201~"
+	defaultWidth      = 80
+)
+
+type keyCode int
+
+const (
+	keyNone keyCode = iota
+	keyRune
+	keyPaste
+	keyEnter
+	keyNewline
+	keyInterrupt
+	keyEOF
+	keyCancel
+	keyEscape
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyWordLeft
+	keyWordRight
+	keyDeleteWordLeft
+	keyDeleteWordRight
+	keyKillLineStart
+	keyKillLineEnd
+	keyClear
+	keySearch
+)
+
+type key struct {
+	code keyCode
+	r    rune
+	text string // pasted text
+}
+
+// Editor reads queries from a terminal in raw mode.
+//
+// Enter starts a new line unless Complete reports that the text is a
+// complete query, in which case it is returned. Ctrl+D always returns the
+// text, or io.EOF when there is none.
+type Editor struct {
+	Prompt             string
+	ContinuationPrompt string
+	History            *History
+	Complete           func(text string) bool
+
+	fd  int
+	in  *bufio.Reader
+	out io.Writer
+
+	buf       []rune
+	pos       int
+	cursorRow int // terminal rows between the first prompt row and the cursor
+	histIdx   int
+	pending   []rune // the unsubmitted text while browsing history
+	unread    *key
+}
+
+// New returns an editor that reads keys from in, which must be a
+// terminal, and draws on out.
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{
+		fd:  int(in.Fd()),
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+// ReadQuery reads one query. The terminal is in raw mode only while it
+// runs, so the caller can print normally in between.
+func (e *Editor) ReadQuery() (string, error) {
+	old, err := term.MakeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(e.fd, old)
+	io.WriteString(e.out, bracketedPasteOn)
+	defer io.WriteString(e.out, bracketedPasteOff)
+
+	e.buf, e.pos, e.cursorRow = nil, 0, 0
+	e.pending, e.unread = nil, nil
+	e.histIdx = e.historyLen()
+	e.refresh()
+
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			e.finish("")
+			return "", err
+		}
+		switch k.code {
+		case keyRune:
+			e.insert(k.r)
+		case keyPaste:
+			e.insert([]rune(k.text)...)
+		case keyEnter:
+			text := string(e.buf)
+			if e.Complete == nil || !e.Complete(text) {
+				e.insert('\n')
+				break
+			}
+			return e.submit(text)
+		case keyNewline:
+			e.insert('\n')
+		case keyEOF:
+			if len(e.buf) == 0 {
+				e.finish("")
+				return "", io.EOF
+			}
+			return e.submit(string(e.buf))
+		case keyInterrupt:
+			e.finish("^C")
+			return "", ErrInterrupted
+		case keyBackspace:
+			if e.pos > 0 {
+				e.buf = slices.Delete(e.buf, e.pos-1, e.pos)
+				e.pos--
+			}
+		case keyDelete:
+			if e.pos < len(e.buf) {
+				e.buf = slices.Delete(e.buf, e.pos, e.pos+1)
+			}
+		case keyLeft:
+			e.pos = max(e.pos-1, 0)
+		case keyRight:
+			e.pos = min(e.pos+1, len(e.buf))
+		case keyUp:
+			e.lineUp()
+		case keyDown:
+			e.lineDown()
+		case keyHome:
+			e.pos = e.lineStart(e.pos)
+		case keyEnd:
+			e.pos = e.lineEnd(e.pos)
+		case keyWordLeft:
+			e.pos = e.wordLeft(e.pos)
+		case keyWordRight:
+			e.pos = e.wordRight(e.pos)
+		case keyDeleteWordLeft:
+			start := e.wordLeft(e.pos)
+			e.buf = slices.Delete(e.buf, start, e.pos)
+			e.pos = start
+		case keyDeleteWordRight:
+			e.buf = slices.Delete(e.buf, e.pos, e.wordRight(e.pos))
+		case keyKillLineStart:
+			start := e.lineStart(e.pos)
+			e.buf = slices.Delete(e.buf, start, e.pos)
+			e.pos = start
+		case keyKillLineEnd:
+			e.buf = slices.Delete(e.buf, e.pos, e.lineEnd(e.pos))
+		case keyClear:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+			e.cursorRow = 0
+		case keySearch:
+			if err := e.search(); err != nil {
+				e.finish("")
+				return "", err
+			}
+		}
+		e.refresh()
+	}
+}
+
+func (e *Editor) submit(text string) (string, error) {
+	e.finish("")
+	if e.History != nil {
+		if err := e.History.Add(text); err != nil {
+			fmt.Fprintf(e.out, "warning: history: %v\r\n", err)
+		}
+	}
+	return text, nil
+}
+
+// finish redraws the text with the cursor at its end, so that output
+// continues below it.
+func (e *Editor) finish(suffix string) {
+	e.pos = len(e.buf)
+	e.refresh()
+	io.WriteString(e.out, suffix+"\r\n")
+	e.cursorRow = 0
+}
+
+func (e *Editor) insert(rs ...rune) {
+	e.buf = slices.Insert(e.buf, e.pos, rs...)
+	e.pos += len(rs)
+}
+
+func (e *Editor) lineStart(pos int) int {
+	for pos > 0 && e.buf[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+func (e *Editor) lineEnd(pos int) int {
+	for pos < len(e.buf) && e.buf[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+// lineUp moves to the same column on the previous line, or to the previous
+// history entry from the first line.
+func (e *Editor) lineUp() {
+	start := e.lineStart(e.pos)
+	if start == 0 {
+		e.historyPrev()
+		return
+	}
+	prev := e.lineStart(start - 1)
+	e.pos = min(prev+e.pos-start, start-1)
+}
+
+// lineDown moves to the same column on the next line, or to the next
+// history entry from the last line.
+func (e *Editor) lineDown() {
+	end := e.lineEnd(e.pos)
+	if end == len(e.buf) {
+		e.historyNext()
+		return
+	}
+	next := end + 1
+	e.pos = min(next+e.pos-e.lineStart(e.pos), e.lineEnd(next))
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (e *Editor) wordLeft(pos int) int {
+	for pos > 0 && !isWordRune(e.buf[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(e.buf[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+func (e *Editor) wordRight(pos int) int {
+	for pos < len(e.buf) && !isWordRune(e.buf[pos]) {
+		pos++
+	}
+	for pos < len(e.buf) && isWordRune(e.buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func (e *Editor) historyLen() int {
+	if e.History == nil {
+		return 0
+	}
+	return e.History.Len()
+}
+
+func (e *Editor) historyPrev() {
+	if e.histIdx == 0 {
+		return
+	}
+	if e.histIdx == e.historyLen() {
+		e.pending = slices.Clone(e.buf)
+	}
+	e.histIdx--
+	e.buf = []rune(e.History.Entry(e.histIdx))
+	e.pos = len(e.buf)
+}
+
+func (e *Editor) historyNext() {
+	if e.histIdx >= e.historyLen() {
+		return
+	}
+	e.histIdx++
+	if e.histIdx == e.historyLen() {
+		e.buf = e.pending
+	} else {
+		e.buf = []rune(e.History.Entry(e.histIdx))
+	}
+	e.pos = len(e.buf)
+}
+
+// search runs a reverse incremental history search. Ctrl+R again finds
+// the next older match. Enter or Escape accept the match for editing, any
+// other editing key accepts it and is then handled as usual, and Ctrl+G or
+// Ctrl+C restore the text from before the search.
+func (e *Editor) search() error {
+	var (
+		pattern []rune
+		match   = -1
+		from    = e.historyLen() - 1
+	)
+	for {
+		e.renderSearch(pattern, match)
+		k, err := e.readKey()
+		if err != nil {
+			return err
+		}
+		switch k.code {
+		case keyRune, keyPaste:
+			if k.code == keyRune {
+				pattern = append(pattern, k.r)
+			} else {
+				pattern = append(pattern, []rune(k.text)...)
+			}
+			if match >= 0 {
+				from = match
+			}
+			match = e.findHistory(string(pattern), from)
+		case keyBackspace:
+			if len(pattern) > 0 {
+				pattern = pattern[:len(pattern)-1]
+			}
+			from = e.historyLen() - 1
+			match = e.findHistory(string(pattern), from)
+		case keySearch:
+			if match > 0 {
+				if m := e.findHistory(string(pattern), match-1); m >= 0 {
+					match = m
+				}
+			}
+		case keyCancel, keyInterrupt:
+			return nil
+		default:
+			if match >= 0 {
+				entry := e.History.Entry(match)
+				e.buf = []rune(entry)
+				e.pos = len([]rune(entry[:strings.Index(entry, string(pattern))]))
+				e.histIdx = match
+			}
+			if k.code != keyEnter && k.code != keyEscape {
+				e.unread = &k
+			}
+			return nil
+		}
+	}
+}
+
+// findHistory returns the newest entry at or before from that contains
+// pattern, or -1.
+func (e *Editor) findHistory(pattern string, from int) int {
+	if pattern == "" {
+		return -1
+	}
+	for i := min(from, e.historyLen()-1); i >= 0; i-- {
+		if strings.Contains(e.History.Entry(i), pattern) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *Editor) renderSearch(pattern []rune, match int) {
+	prompt := fmt.Sprintf("(reverse-i-search)`%s': ", string(pattern))
+	if match < 0 {
+		if len(pattern) > 0 {
+			prompt = "(failed " + prompt[1:]
+		}
+		e.render(prompt, e.buf, e.pos)
+		return
+	}
+	entry := e.History.Entry(match)
+	pos := len([]rune(entry[:strings.Index(entry, string(pattern))]))
+	e.render(prompt, []rune(entry), pos)
+}
+
+func (e *Editor) refresh() {
+	e.render(e.Prompt, e.buf, e.pos)
+}
+
+// render redraws text from the first prompt row and places the cursor at
+// pos. Lines wider than the terminal wrap, so rows are counted per line.
+func (e *Editor) render(prompt string, text []rune, pos int) {
+	width := e.width()
+	var b strings.Builder
+	if e.cursorRow > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", e.cursorRow)
+	}
+	b.WriteString("\r\x1b[J")
+
+	var (
+		row, offset    int
+		curRow, curCol int
+	)
+	lines := strings.Split(string(text), "\n")
+	for i, line := range lines {
+		p := prompt
+		if i > 0 {
+			p = e.ContinuationPrompt
+		}
+		n := len([]rune(line))
+		b.WriteString(p)
+		b.WriteString(strings.ReplaceAll(line, "\t", " "))
+		w := len([]rune(p)) + n
+		if pos >= offset && pos <= offset+n {
+			c := len([]rune(p)) + pos - offset
+			curRow, curCol = row+c/width, c%width
+		}
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+			row += max(1, (w+width-1)/width)
+		} else {
+			// Leave the terminal's pending-wrap state after a full row.
+			if w > 0 && w%width == 0 {
+				b.WriteString("\r\n")
+			}
+			row += w / width
+		}
+		offset += n + 1
+	}
+
+	if row > curRow {
+		fmt.Fprintf(&b, "\x1b[%dA", row-curRow)
+	}
+	b.WriteString("\r")
+	if curCol > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", curCol)
+	}
+	e.cursorRow = curRow
+	io.WriteString(e.out, b.String())
+}
+
+func (e *Editor) width() int {
+	if w, _, err := term.GetSize(e.fd); err == nil && w > 0 {
+		return w
+	}
+	return defaultWidth
+}
+
+func (e *Editor) readKey() (key, error) {
+	if e.unread != nil {
+		k := *e.unread
+		e.unread = nil
+		return k, nil
+	}
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return key{}, err
+	}
+	switch r {
+	case 0x01: // Ctrl+A
+		return key{code: keyHome}, nil
+	case 0x02: // Ctrl+B
+		return key{code: keyLeft}, nil
+	case 0x03: // Ctrl+C
+		return key{code: keyInterrupt}, nil
+	case 0x04: // Ctrl+D
+		return key{code: keyEOF}, nil
+	case 0x05: // Ctrl+E
+		return key{code: keyEnd}, nil
+	case 0x06: // Ctrl+F
+		return key{code: keyRight}, nil
+	case 0x07: // Ctrl+G
+		return key{code: keyCancel}, nil
+	case 0x08, 0x7f: // Ctrl+H, Backspace
+		return key{code: keyBackspace}, nil
+	case '\t':
+		return key{code: keyRune, r: r}, nil
+	case '\n': // Ctrl+J
+		return key{code: keyNewline}, nil
+	case 0x0b: // Ctrl+K
+		return key{code: keyKillLineEnd}, nil
+	case 0x0c: // Ctrl+L
+		return key{code: keyClear}, nil
+	case '\r':
+		return key{code: keyEnter}, nil
+	case 0x0e: // Ctrl+N
+		return key{code: keyDown}, nil
+	case 0x10: // Ctrl+P
+		return key{code: keyUp}, nil
+	case 0x12: // Ctrl+R
+		return key{code: keySearch}, nil
+	case 0x15: // Ctrl+U
+		return key{code: keyKillLineStart}, nil
+	case 0x17: // Ctrl+W
+		return key{code: keyDeleteWordLeft}, nil
+	case 0x1b:
+		return e.readEscape()
+	}
+	if r < 0x20 {
+		return key{code: keyNone}, nil
+	}
+	return key{code: keyRune, r: r}, nil
+}
+
+// readEscape decodes the sequence following ESC. Terminals send a whole
+// sequence at once, so ESC with nothing buffered after it is the Escape
+// key itself.
+func (e *Editor) readEscape() (key, error) {
+	if e.in.Buffered() == 0 {
+		return key{code: keyEscape}, nil
+	}
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return key{}, err
+	}
+	switch b {
+	case '[':
+		return e.readCSI()
+	case 'O':
+		c, err := e.in.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		return cursorKey(c, ""), nil
+	case 'b':
+		return key{code: keyWordLeft}, nil
+	case 'f':
+		return key{code: keyWordRight}, nil
+	case 'd':
+		return key{code: keyDeleteWordRight}, nil
+	case 0x08, 0x7f: // Alt+Backspace
+		return key{code: keyDeleteWordLeft}, nil
+	}
+	return key{code: keyNone}, nil
+}
+
+func (e *Editor) readCSI() (key, error) {
+	var params []byte
+	for {
+		c, err := e.in.ReadByte()
+		if err != nil {
+			return key{}, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			if c != '~' {
+				return cursorKey(c, string(params)), nil
+			}
+			break
+		}
+		params = append(params, c)
+	}
+	switch string(params) {
+	case "1", "7":
+		return key{code: keyHome}, nil
+	case "4", "8":
+		return key{code: keyEnd}, nil
+	case "3":
+		return key{code: keyDelete}, nil
+	case "200":
+		text, err := e.readPaste()
+		return key{code: keyPaste, text: text}, err
+	}
+	return key{code: keyNone}, nil
+}
+
+// cursorKey maps the final byte of an arrow, Home or End sequence. A
+// modifier parameter of 3 (Alt) or 5 (Ctrl) turns Left and Right into
+// word movement.
+func cursorKey(c byte, params string) key {
+	word := strings.HasSuffix(params, ";3") || strings.HasSuffix(params, ";5")
+	switch c {
+	case 'A':
+		return key{code: keyUp}
+	case 'B':
+		return key{code: keyDown}
+	case 'C':
+		if word {
+			return key{code: keyWordRight}
+		}
+		return key{code: keyRight}
+	case 'D':
+		if word {
+			return key{code: keyWordLeft}
+		}
+		return key{code: keyLeft}
+	case 'H':
+		return key{code: keyHome}
+	case 'F':
+		return key{code: keyEnd}
+	}
+	return key{code: keyNone}
+}
+
+// readPaste reads a bracketed paste up to its end marker. Line endings are
+// normalised to \n and other control characters are dropped.
+func (e *Editor) readPaste() (string, error) {
+	var raw []byte
+	for !bytes.HasSuffix(raw, []byte(pasteEnd)) {
+		c, err := e.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		raw = append(raw, c)
+	}
+	text := strings.TrimSuffix(string(raw), pasteEnd)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, text), nil
+}
@@ -0,0 +1,187 @@
+package editor
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+// newTestEditor returns an editor that reads keys from input. The whole
+// input is buffered at the first read, as a terminal's sequences are.
+func newTestEditor(input string) *Editor {
+	return &Editor{in: bufio.NewReader(strings.NewReader(input)), out: io.Discard}
+}
+
+func TestReadKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  key
+	}{
+		{"rune", "x", key{code: keyRune, r: 'x'}},
+		{"multibyte rune", "ż", key{code: keyRune, r: 'ż'}},
+		{"tab", "\t", key{code: keyRune, r: '\t'}},
+		{"enter", "\r", key{code: keyEnter}},
+		{"ctrl+j", "\n", key{code: keyNewline}},
+		{"ctrl+a", "\x01", key{code: keyHome}},
+		{"ctrl+c", "\x03", key{code: keyInterrupt}},
+		{"ctrl+d", "\x04", key{code: keyEOF}},
+		{"ctrl+g", "\x07", key{code: keyCancel}},
+		{"backspace", "\x7f", key{code: keyBackspace}},
+		{"ctrl+h", "\x08", key{code: keyBackspace}},
+		{"ctrl+r", "\x12", key{code: keySearch}},
+		{"ctrl+w", "\x17", key{code: keyDeleteWordLeft}},
+		{"other control", "\x1c", key{code: keyNone}},
+		{"escape", "\x1b", key{code: keyEscape}},
+		{"up", "\x1b[A", key{code: keyUp}},
+		{"down", "\x1b[B", key{code: keyDown}},
+		{"right", "\x1b[C", key{code: keyRight}},
+		{"left", "\x1b[D", key{code: keyLeft}},
+		{"ss3 up", "\x1bOA", key{code: keyUp}},
+		{"ss3 home", "\x1bOH", key{code: keyHome}},
+		{"home", "\x1b[H", key{code: keyHome}},
+		{"end", "\x1b[F", key{code: keyEnd}},
+		{"vt home", "\x1b[1~", key{code: keyHome}},
+		{"rxvt home", "\x1b[7~", key{code: keyHome}},
+		{"vt end", "\x1b[4~", key{code: keyEnd}},
+		{"rxvt end", "\x1b[8~", key{code: keyEnd}},
+		{"delete", "\x1b[3~", key{code: keyDelete}},
+		{"ctrl+right", "\x1b[1;5C", key{code: keyWordRight}},
+		{"ctrl+left", "\x1b[1;5D", key{code: keyWordLeft}},
+		{"alt+right", "\x1b[1;3C", key{code: keyWordRight}},
+		{"shift+right", "\x1b[1;2C", key{code: keyRight}},
+		{"alt+b", "\x1bb", key{code: keyWordLeft}},
+		{"alt+f", "\x1bf", key{code: keyWordRight}},
+		{"alt+d", "\x1bd", key{code: keyDeleteWordRight}},
+		{"alt+backspace", "\x1b\x7f", key{code: keyDeleteWordLeft}},
+		{"unknown csi", "\x1b[15~", key{code: keyNone}},
+		{"paste", "\x1b[200~SELECT 1\x1b[201~", key{code: keyPaste, text: "SELECT 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEditor(tt.input)
+			got, err := e.readKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("readKey(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+			if n := e.in.Buffered(); n != 0 {
+				t.Errorf("readKey(%q) left %d bytes unread", tt.input, n)
+			}
+		})
+	}
+}
+
+func TestReadKeySequence(t *testing.T) {
+	e := newTestEditor("a\x1b[Db\r")
+	want := []key{{code: keyRune, r: 'a'}, {code: keyLeft}, {code: keyRune, r: 'b'}, {code: keyEnter}}
+	for i, w := range want {
+		got, err := e.readKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != w {
+			t.Errorf("key %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if _, err := e.readKey(); err != io.EOF {
+		t.Errorf("readKey at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadPaste(t *testing.T) {
+	tests := []struct {
+		name  string
+		paste string
+		want  string
+	}{
+		{"plain", "SELECT 1", "SELECT 1"},
+		{"crlf", "SELECT 1\r\nFROM t\r\n", "SELECT 1\nFROM t\n"},
+		{"cr", "SELECT 1\rFROM t", "SELECT 1\nFROM t"},
+		{"tab", "SELECT\t1", "SELECT\t1"},
+		{"control characters", "SELECT\x07 1\x00", "SELECT 1"},
+		// Keys inside a paste are text, not editing commands.
+		{"escape sequence", "a\x1b[Db", "a[Db"},
+		{"unicode", "SELECT 'zażółć'", "SELECT 'zażółć'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEditor("\x1b[200~" + tt.paste + pasteEnd + "x")
+			got, err := e.readKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.code != keyPaste || got.text != tt.want {
+				t.Errorf("paste %q = %+v, want text %q", tt.paste, got, tt.want)
+			}
+			// The key after the paste is read as usual.
+			if k, _ := e.readKey(); k != (key{code: keyRune, r: 'x'}) {
+				t.Errorf("key after paste = %+v, want x", k)
+			}
+		})
+	}
+}
+
+func TestReadPasteUnterminated(t *testing.T) {
+	e := newTestEditor("\x1b[200~SELECT 1")
+	if _, err := e.readKey(); err != io.EOF {
+		t.Errorf("unterminated paste: err = %v, want io.EOF", err)
+	}
+}
+
+func TestWordMovement(t *testing.T) {
+	const text = "SELECT a.b_1,  count(*)\nFROM t"
+	tests := []struct {
+		pos   int
+		left  int
+		right int
+	}{
+		{0, 0, 6},   // start of text
+		{3, 0, 6},   // inside SELECT
+		{6, 0, 8},   // after SELECT
+		{7, 0, 8},   // before a
+		{9, 7, 12},  // after the dot
+		{12, 9, 20}, // after b_1
+		{15, 9, 20}, // before count
+		{23, 15, 28},
+		{24, 15, 28}, // start of the second line
+		{30, 29, 30}, // end of text
+	}
+	e := &Editor{buf: []rune(text)}
+	for _, tt := range tests {
+		if got := e.wordLeft(tt.pos); got != tt.left {
+			t.Errorf("wordLeft(%d) = %d, want %d", tt.pos, got, tt.left)
+		}
+		if got := e.wordRight(tt.pos); got != tt.right {
+			t.Errorf("wordRight(%d) = %d, want %d", tt.pos, got, tt.right)
+		}
+	}
+}
+
+func TestLineMovement(t *testing.T) {
+	e := &Editor{buf: []rune("SELECT a,\n  b\nFROM t")}
+	// From column 8 of the first line down to the short second line,
+	// which clamps to its end, then on to the third.
+	e.pos = 8
+	e.lineDown()
+	if e.pos != 13 {
+		t.Errorf("lineDown from 8 = %d, want 13", e.pos)
+	}
+	e.lineDown()
+	if e.pos != 17 {
+		t.Errorf("lineDown from 13 = %d, want 17", e.pos)
+	}
+	e.lineUp()
+	if e.pos != 13 {
+		t.Errorf("lineUp from 17 = %d, want 13", e.pos)
+	}
+	if got := e.lineStart(12); got != 10 {
+		t.Errorf("lineStart(12) = %d, want 10", got)
+	}
+	if got := e.lineEnd(10); got != 13 {
+		t.Errorf("lineEnd(10) = %d, want 13", got)
+	}
+}
@@ -0,0 +1,132 @@
+package editor
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// historyFile is created in the user's home directory.
+const historyFile = ".query_stats_history"
+
+// maxHistory is the number of entries kept in memory. The file itself is
+// only ever appended to.
+const maxHistory = 1000
+
+// History is the list of previously run queries, oldest first. Queries can
+// span several lines, so each one is stored on a single line of the file
+// with newlines and backslashes escaped.
+type History struct {
+	path    string
+	entries []string
+}
+
+// DefaultHistoryPath returns ~/.query_stats_history, or "" when the home
+// directory is unknown.
+func DefaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFile)
+}
+
+// LoadHistory reads the history file at path. A missing file is an empty
+// history, and an empty path keeps the history in memory only.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			h.entries = append(h.entries, unescapeEntry(line))
+		}
+	}
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+	return h, sc.Err()
+}
+
+// Add appends entry to the history and to the history file. Blank entries
+// and repeats of the last entry are skipped.
+func (h *History) Add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(escapeEntry(entry) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Len returns the number of entries.
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// Entry returns the i-th entry, oldest first.
+func (h *History) Entry(i int) string {
+	return h.entries[i]
+}
+
+// escapeEntry puts s on one line. Backslashes are doubled first, so
+// a literal \n in the query stays distinct from an escaped newline.
+func escapeEntry(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\r", `\r`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// unescapeEntry reverses escapeEntry. A backslash before any other
+// character, as in a hand-edited file, is kept as written.
+func unescapeEntry(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte('\\')
+			continue
+		}
+		i++
+	}
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEscapeEntry(t *testing.T) {
+	tests := []struct {
+		entry   string
+		escaped string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT 1\nFROM t", `SELECT 1\nFROM t`},
+		{`SELECT 'a\nb'`, `SELECT 'a\\nb'`},
+		{"SELECT 'a\\\n'", `SELECT 'a\\\n'`},
+		{`SELECT 'C:\\'`, `SELECT 'C:\\\\'`},
+		{"SELECT 1\r\nFROM t", `SELECT 1\r\nFROM t`},
+		{`SELECT '\'`, `SELECT '\\'`},
+	}
+	for _, tt := range tests {
+		got := escapeEntry(tt.entry)
+		if got != tt.escaped {
+			t.Errorf("escapeEntry(%q) = %q, want %q", tt.entry, got, tt.escaped)
+		}
+		if back := unescapeEntry(got); back != tt.entry {
+			t.Errorf("unescapeEntry(%q) = %q, want %q", got, back, tt.entry)
+		}
+	}
+}
+
+func TestUnescapeEntryUnknown(t *testing.T) {
+	// A stray backslash, as in a hand-edited file, is kept.
+	for in, want := range map[string]string{
+		`SELECT '\t'`: `SELECT '\t'`,
+		`trailing \`:  `trailing \`,
+	} {
+		if got := unescapeEntry(in); got != want {
+			t.Errorf("unescapeEntry(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFile)
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []string{
+		"SELECT 1",
+		"SELECT a\nFROM t\nWHERE b = 'x\\ny'",
+		`SELECT '\\'`,
+	}
+	for _, e := range entries {
+		if err := h.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Blank entries and repeats of the last one are not added.
+	for _, e := range []string{"  ", entries[2], " " + entries[2] + "\n"} {
+		if err := h.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err = LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Len() != len(entries) {
+		t.Fatalf("loaded %d entries, want %d", h.Len(), len(entries))
+	}
+	for i, want := range entries {
+		if got := h.Entry(i); got != want {
+			t.Errorf("entry %d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestHistoryTrim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFile)
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = maxHistory + 5
+	for i := range n {
+		if err := h.Add(fmt.Sprintf("SELECT %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if h.Len() != maxHistory {
+		t.Errorf("kept %d entries in memory, want %d", h.Len(), maxHistory)
+	}
+	if got, want := h.Entry(0), "SELECT 5"; got != want {
+		t.Errorf("oldest entry = %q, want %q", got, want)
+	}
+
+	// The file keeps every entry; loading keeps the newest.
+	h, err = LoadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Len() != maxHistory {
+		t.Errorf("loaded %d entries, want %d", h.Len(), maxHistory)
+	}
+	if got, want := h.Entry(0), "SELECT 5"; got != want {
+		t.Errorf("oldest loaded entry = %q, want %q", got, want)
+	}
+	if got, want := h.Entry(h.Len()-1), fmt.Sprintf("SELECT %d", n-1); got != want {
+		t.Errorf("newest loaded entry = %q, want %q", got, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != n {
+		t.Errorf("history file has %d lines, want %d", lines, n)
+	}
+}
+
+func TestLoadHistoryMissing(t *testing.T) {
+	h, err := LoadHistory(filepath.Join(t.TempDir(), "nosuch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Len() != 0 {
+		t.Errorf("missing file loaded %d entries, want none", h.Len())
+	}
+}
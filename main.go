@@ -1,7 +1,7 @@
 package main
 
 import (
-    "bufio"
+    "errors"
     "fmt"
     "io"
     "os"
@@ -10,6 +10,7 @@ import (
 
     "github.com/dbnski/query-stats/config"
     "github.com/dbnski/query-stats/dsn"
+    "github.com/dbnski/query-stats/editor"
     "github.com/dbnski/query-stats/runner"
     "github.com/alecthomas/kong"
     "golang.org/x/term"
@@ -23,69 +24,105 @@ var (
 )
 
 func readQueryFromTerminal() (string, error) {
-    fd := int(os.Stdin.Fd())
-    old, err := term.MakeRaw(fd)
+    history, err := editor.LoadHistory(editor.DefaultHistoryPath())
     if err != nil {
-        data, err := io.ReadAll(os.Stdin)
-        return string(data), err
+        fmt.Fprintln(os.Stderr, "warning: history:", err)
+        history, _ = editor.LoadHistory("")
     }
-    defer term.Restore(fd, old)
+    ed := editor.New(os.Stdin, os.Stderr)
+    ed.Prompt = "query> "
+    ed.ContinuationPrompt = "    -> "
+    ed.History = history
 
-    fmt.Fprint(os.Stderr, "Enter query (Ctrl+D to run, Ctrl+C to abort):\r\n")
+    fmt.Fprintln(os.Stderr, "Enter query (Ctrl+D to run, Ctrl+C to abort, Ctrl+R to search history):")
+    q, err := ed.ReadQuery()
+    if errors.Is(err, editor.ErrInterrupted) {
+        os.Exit(1)
+    }
+    if err == io.EOF {
+        return "", nil
+    }
+    return q, err
+}
 
-    var buf []byte
-    in := bufio.NewReader(os.Stdin)
+func printDefaults(d *dsn.MySQL) {
+    settings := d.Settings()
+    width, valueWidth := 0, 0
+    for _, s := range settings {
+        width = max(width, len(s.Name))
+        valueWidth = max(valueWidth, len(s.Value))
+    }
+    fmt.Println(d.String())
+    for _, s := range settings {
+        fmt.Printf("  %-*s  %-*s  %s\n", width, s.Name, valueWidth, s.Value, s.Origin)
+    }
+}
 
-    for {
-        b, err := in.ReadByte()
+// sessionOptions builds the runner options shared by single queries and
+// the interactive shell. It exits if the init file cannot be read.
+func sessionOptions(cli *config.CLI) runner.Options {
+    initCommands := cli.InitCommand
+    if cli.InitFile != "" {
+        data, err := os.ReadFile(cli.InitFile)
         if err != nil {
-            if err == io.EOF {
-                break
-            }
-            return "", err
+            fmt.Fprintln(os.Stderr, "error: init file:", err)
+            os.Exit(1)
         }
+        if sql := strings.TrimSpace(string(data)); sql != "" {
+            initCommands = append(initCommands, sql)
+        }
+    }
 
-        switch b {
-        case 0x03: // Ctrl+C
-            fmt.Fprint(os.Stderr, "^C\r\n")
-            os.Exit(1)
+    return runner.Options{
+        SetVars:          cli.SetVar,
+        BinaryMode:       cli.Mode == "binary",
+        MaxExecutionTime: cli.MaxExecutionTime,
+        AllowWrites:      cli.AllowWrites,
+        DMLRollback:      cli.DMLRollback,
+        SplitStatements:  cli.SplitStatements,
+        InitCommands:     initCommands,
+        Progress:         term.IsTerminal(int(os.Stderr.Fd())),
+    }
+}
 
-        case 0x04: // Ctrl+D — end of input
-            fmt.Fprint(os.Stderr, "\r\n")
-            return string(buf), nil
-
-        case 0x7f, 0x08: // Backspace / DEL
-            if len(buf) > 0 {
-                buf = buf[:len(buf)-1]
-                fmt.Fprint(os.Stderr, "\b \b")
-            }
-
-        case '\r': // Enter — newline in the query
-            buf = append(buf, '\n')
-            fmt.Fprint(os.Stderr, "\r\n")
-
-        case 0x1b: // Escape — swallow CSI sequences (arrow keys, etc.)
-            if peeked, _ := in.Peek(1); len(peeked) > 0 && peeked[0] == '[' {
-                in.ReadByte() // consume '['
-                for {
-                    c, err := in.ReadByte()
-                    if err != nil {
-                        break
-                    }
-                    // CSI sequences end at a letter or '~'
-                    if c >= 0x40 && c <= 0x7e {
-                        break
-                    }
-                }
-            }
-
-        default:
-            buf = append(buf, b)
-            fmt.Fprintf(os.Stderr, "%c", b)
-        }
+func loadOptions(cli *config.CLI) runner.LoadOptions {
+    return runner.LoadOptions{
+        Concurrency: cli.Concurrency,
+        Duration:    cli.Duration,
+        QPS:         cli.QPS,
     }
+}
 
-    return string(buf), nil
+// exitStatus maps an error to the documented exit status.
+func exitStatus(err error) int {
+    switch {
+    case errors.Is(err, runner.ErrQueryTimeout):
+        return 2
+    case runner.IsNetworkError(err):
+        return 3
+    default:
+        return 1
+    }
+}
+
+// templateVars merges the vars file with --define, which wins.
+func templateVars(cli *config.CLI) (map[string]any, error) {
+    vars := make(map[string]any)
+    if cli.VarsFile != "" {
+        loaded, err := runner.LoadVars(cli.VarsFile)
+        if err != nil {
+            return nil, err
+        }
+        vars = loaded
+    }
+    for _, d := range cli.Define {
+        key, value, err := runner.ParseDefine(d)
+        if err != nil {
+            return nil, err
+        }
+        vars[key] = value
+    }
+    return vars, nil
 }
 
 func main() {
@@ -112,21 +149,54 @@ func main() {
         }
     }
 
-    var query string
-    if term.IsTerminal(int(os.Stdin.Fd())) {
-        q, err := readQueryFromTerminal()
+    if cli.PrintDefaults {
+        printDefaults(cli.DSN)
+        return
+    }
+
+    if cli.Slowlog != "" {
+        err := runner.RunSlowLog(cli.DSN, cli.Slowlog, cli.Top, sessionOptions(cli))
         if err != nil {
-            fmt.Fprintln(os.Stderr, "error reading query:", err)
-            os.Exit(1)
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(exitStatus(err))
+        }
+        return
+    }
+
+    if cli.Digests {
+        err := runner.RunDigests(cli.DSN, cli.RankBy, cli.Top, sessionOptions(cli))
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(exitStatus(err))
         }
-        query = strings.TrimSpace(q)
-    } else {
-        raw, err := io.ReadAll(os.Stdin)
+        return
+    }
+
+    if cli.Workload != "" {
+        err := runner.RunWorkload(cli.DSN, cli.Workload, loadOptions(cli), sessionOptions(cli))
         if err != nil {
-            fmt.Fprintln(os.Stderr, "error reading stdin:", err)
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(exitStatus(err))
+        }
+        return
+    }
+
+    if cli.Interactive {
+        if !term.IsTerminal(int(os.Stdin.Fd())) {
+            fmt.Fprintln(os.Stderr, "error: --interactive needs a terminal")
             os.Exit(1)
         }
-        query = strings.TrimSpace(string(raw))
+        if err := runShell(cli.DSN, sessionOptions(cli)); err != nil {
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(exitStatus(err))
+        }
+        return
+    }
+
+    query, err := readQuery(cli)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "error reading query:", err)
+        os.Exit(1)
     }
 
     if query == "" {
@@ -134,8 +204,54 @@ func main() {
         os.Exit(1)
     }
 
-    if err := runner.Run(cli.DSN, query, cli.SetVar, cli.Mode == "binary"); err != nil {
+    rendered := false
+    // Only an explicit --define or --vars-file makes the query a template;
+    // "{{" can occur in ordinary SQL, e.g. in a string literal.
+    if len(cli.Define) > 0 || cli.VarsFile != "" {
+        vars, err := templateVars(cli)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(1)
+        }
+        if query, err = runner.RenderQuery(query, vars); err != nil {
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(1)
+        }
+        query = strings.TrimSpace(query)
+        rendered = true
+    }
+
+    var params [][]any
+    if cli.ParamsFile != "" {
+        rows, err := runner.LoadParams(cli.ParamsFile)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(1)
+        }
+        params = rows
+    } else if len(cli.Param) > 0 {
+        row := make([]any, len(cli.Param))
+        for i, p := range cli.Param {
+            row[i] = runner.ParseParam(p)
+        }
+        params = [][]any{row}
+    }
+
+    if cli.Concurrency > 0 {
+        opts := sessionOptions(cli)
+        opts.EchoQuery = rendered
+        if err := runner.RunLoad(cli.DSN, query, loadOptions(cli), opts); err != nil {
+            fmt.Fprintln(os.Stderr, "error:", err)
+            os.Exit(exitStatus(err))
+        }
+        return
+    }
+
+    opts := sessionOptions(cli)
+    opts.Params = params
+    opts.EchoQuery = rendered
+    if err := runner.Run(cli.DSN, query, opts); err != nil {
         fmt.Fprintln(os.Stderr, "error:", err)
-        os.Exit(1)
+        os.Exit(exitStatus(err))
     }
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "strings"
+
+    "github.com/dbnski/query-stats/config"
+    "golang.org/x/term"
+)
+
+// readQuery returns the query from the first source given: --query, a
+// query file, or stdin (the editor when stdin is a terminal). With --edit
+// that text is only the starting point and the query is whatever is saved
+// in $EDITOR.
+func readQuery(cli *config.CLI) (string, error) {
+    // The editor takes over stdin, which must be the terminal.
+    if cli.Edit && !term.IsTerminal(int(os.Stdin.Fd())) {
+        return "", errors.New("--edit needs a terminal")
+    }
+    var (
+        query string
+        err   error
+    )
+    switch {
+    case cli.Query != "":
+        query = cli.Query
+    case cli.QueryFile != "":
+        var data []byte
+        data, err = os.ReadFile(cli.QueryFile)
+        query = string(data)
+    case cli.Edit:
+        // nothing to start from
+    case term.IsTerminal(int(os.Stdin.Fd())):
+        query, err = readQueryFromTerminal()
+    default:
+        var data []byte
+        data, err = io.ReadAll(os.Stdin)
+        query = string(data)
+    }
+    if err != nil {
+        return "", err
+    }
+    if cli.Edit {
+        if query, err = editQuery(query); err != nil {
+            return "", err
+        }
+    }
+    return strings.TrimSpace(query), nil
+}
+
+// editQuery opens $VISUAL or $EDITOR (vi when neither is set) on a
+// temporary copy of text and returns what was saved.
+func editQuery(text string) (string, error) {
+    editor := os.Getenv("VISUAL")
+    if editor == "" {
+        editor = os.Getenv("EDITOR")
+    }
+    if editor == "" {
+        editor = "vi"
+    }
+    args := strings.Fields(editor)
+    if len(args) == 0 {
+        return "", errors.New("editor: $EDITOR is blank")
+    }
+
+    f, err := os.CreateTemp("", "query-stats-*.sql")
+    if err != nil {
+        return "", fmt.Errorf("editor: %w", err)
+    }
+    defer os.Remove(f.Name())
+    if _, err := f.WriteString(text); err != nil {
+        f.Close()
+        return "", fmt.Errorf("editor: %w", err)
+    }
+    if err := f.Close(); err != nil {
+        return "", fmt.Errorf("editor: %w", err)
+    }
+
+    cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+    cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+    if err := cmd.Run(); err != nil {
+        return "", fmt.Errorf("editor: %s: %w", args[0], err)
+    }
+    data, err := os.ReadFile(f.Name())
+    if err != nil {
+        return "", fmt.Errorf("editor: %w", err)
+    }
+    return string(data), nil
+}
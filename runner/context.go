@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/client"
+)
+
+// contextVars are the session variables that most often explain why the
+// same query behaves differently on two runs. Servers older than MySQL
+// 5.7.20, and MariaDB before 11.1, only know tx_isolation.
+var contextVars = []string{
+	"sql_mode",
+	"optimizer_switch",
+	"transaction_isolation",
+	"tx_isolation",
+	"character_set_connection",
+	"collation_connection",
+	"sort_buffer_size",
+	"join_buffer_size",
+	"tmp_table_size",
+	"max_heap_table_size",
+}
+
+// sizeVars are shown with a human-readable size next to the byte count.
+var sizeVars = map[string]bool{
+	"sort_buffer_size":    true,
+	"join_buffer_size":    true,
+	"tmp_table_size":      true,
+	"max_heap_table_size": true,
+}
+
+// serverContext is the server and session state the query ran under.
+type serverContext struct {
+	version  string
+	comment  string
+	flavour  string
+	hostname string
+	vars     []contextVar
+}
+
+type contextVar struct {
+	name       string
+	value      string
+	overridden bool // set with --set-var
+}
+
+// getServerContext reads the server identity and the context variables.
+// It runs after session setup, so the values are the ones the query sees.
+// Variables set with --set-var are marked, and listed after the context
+// variables when they are not among them.
+func getServerContext(conn *client.Conn, setVars []varValue) (*serverContext, error) {
+	result, err := conn.Execute("SELECT @@version, @@version_comment, @@hostname")
+	if err != nil {
+		return nil, fmt.Errorf("server context: %w", err)
+	}
+	row := result.Values[0]
+	ctx := &serverContext{
+		version:  string(row[0].AsString()),
+		comment:  string(row[1].AsString()),
+		hostname: string(row[2].AsString()),
+	}
+	ctx.flavour = serverFlavour(ctx.version, ctx.comment)
+	result.Close()
+
+	quoted := make([]string, len(contextVars))
+	for i, name := range contextVars {
+		quoted[i] = "'" + name + "'"
+	}
+	result, err = conn.Execute("SHOW SESSION VARIABLES WHERE Variable_name IN (" + strings.Join(quoted, ", ") + ")")
+	if err != nil {
+		return nil, fmt.Errorf("server context: %w", err)
+	}
+	defer result.Close()
+	values := make(map[string]string)
+	for _, row := range result.Values {
+		values[strings.ToLower(string(row[0].AsString()))] = string(row[1].AsString())
+	}
+
+	overridden := make(map[string]bool)
+	for _, v := range setVars {
+		overridden[v.name] = true
+	}
+	for _, name := range contextVars {
+		value, ok := values[name]
+		if !ok || name == "tx_isolation" && values["transaction_isolation"] != "" {
+			continue
+		}
+		ctx.vars = append(ctx.vars, contextVar{name, value, overridden[name]})
+	}
+	for _, v := range setVars {
+		if _, ok := values[v.name]; !ok {
+			ctx.vars = append(ctx.vars, contextVar{v.name, v.value, true})
+		}
+	}
+	return ctx, nil
+}
+
+func serverFlavour(version, comment string) string {
+	v, c := strings.ToLower(version), strings.ToLower(comment)
+	switch {
+	case strings.Contains(v, "mariadb"):
+		return "MariaDB"
+	case strings.Contains(v, "tidb"):
+		return "TiDB"
+	case strings.Contains(c, "percona"):
+		return "Percona Server"
+	default:
+		return "MySQL"
+	}
+}
+
+func printServerContext(ctx *serverContext) {
+	fmt.Println("=== Context ===")
+	fmt.Printf("  Server:           %s %s", ctx.flavour, ctx.version)
+	if ctx.comment != "" {
+		fmt.Printf(" (%s)", ctx.comment)
+	}
+	fmt.Println()
+	fmt.Printf("  Hostname:         %s\n", ctx.hostname)
+
+	width := 0
+	anyOverridden := false
+	for _, v := range ctx.vars {
+		width = max(width, len(v.name))
+		anyOverridden = anyOverridden || v.overridden
+	}
+	fmt.Println()
+	if anyOverridden {
+		fmt.Println("  Session variables (* set with --set-var):")
+	} else {
+		fmt.Println("  Session variables:")
+	}
+	for _, v := range ctx.vars {
+		mark := " "
+		if v.overridden {
+			mark = "*"
+		}
+		value := v.value
+		if value == "" {
+			value = "''"
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && sizeVars[v.name] {
+			value = fmt.Sprintf("%s (%s)", value, formatBytes(n))
+		}
+		for i, line := range wrapList(value, 60) {
+			if i == 0 {
+				fmt.Printf("  %s %-*s  %s\n", mark, width, v.name, line)
+			} else {
+				fmt.Printf("    %-*s  %s\n", width, "", line)
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// wrapList breaks a comma-separated value such as optimizer_switch into
+// lines of at most width characters, breaking only after commas.
+func wrapList(s string, width int) []string {
+	if len(s) <= width || !strings.Contains(s, ",") {
+		return []string{s}
+	}
+	var (
+		lines []string
+		line  string
+	)
+	for _, item := range strings.SplitAfter(s, ",") {
+		if line != "" && len(line)+len(item) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		line += item
+	}
+	return append(lines, line)
+}
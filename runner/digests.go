@@ -0,0 +1,257 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+
+	"github.com/dbnski/query-stats/dsn"
+)
+
+// Digest ranking orders for RunDigests.
+const (
+	RankByTime = "time"
+	RankByRows = "rows"
+)
+
+const digestQuery = `SELECT IFNULL(SCHEMA_NAME, ''), DIGEST, DIGEST_TEXT, COUNT_STAR,
+       SUM_TIMER_WAIT, SUM_LOCK_TIME, SUM_ROWS_SENT, SUM_ROWS_EXAMINED, QUERY_SAMPLE_TEXT
+  FROM performance_schema.events_statements_summary_by_digest
+ WHERE DIGEST IS NOT NULL AND QUERY_SAMPLE_TEXT IS NOT NULL AND QUERY_SAMPLE_TEXT <> ''
+ ORDER BY %s DESC`
+
+// digestRow is one row of events_statements_summary_by_digest. Timer
+// columns are in picoseconds.
+type digestRow struct {
+	schema       string
+	digest       string
+	text         string
+	count        int64
+	sumTimerWait uint64
+	sumLockTime  uint64
+	rowsSent     int64
+	rowsExamined int64
+	sample       string
+	truncated    bool // sample cut off by performance_schema_max_sql_text_length
+}
+
+func picoseconds(ps uint64) time.Duration {
+	return time.Duration(ps / 1000)
+}
+
+// db returns the schema the digest ran in, or fallback for statements
+// that ran without a default database.
+func (r *digestRow) db(fallback string) string {
+	if r.schema == "" {
+		return fallback
+	}
+	return r.schema
+}
+
+func (r *digestRow) avgLatency() time.Duration {
+	return picoseconds(r.sumTimerWait / uint64(max(r.count, 1)))
+}
+
+// digestResult is a profiled digest: the historical row and the fresh
+// report for its sample.
+type digestResult struct {
+	row *digestRow
+	rep *report
+}
+
+// avgRowSize is the measured bytes per row of the sample.
+func (d *digestResult) avgRowSize() int64 {
+	if rows := d.rep.rowsReturned(); rows > 0 {
+		return d.rep.totalSize() / rows
+	}
+	return 0
+}
+
+// estimatedBytes scales the sample's measured row size by the rows the
+// digest has sent since the statistics were last reset.
+func (d *digestResult) estimatedBytes() int64 {
+	return d.avgRowSize() * d.row.rowsSent
+}
+
+// sqlTextLimit returns performance_schema_max_sql_text_length, or 0 if the
+// server does not have it.
+func sqlTextLimit(conn *client.Conn) int {
+	result, err := conn.Execute("SELECT @@performance_schema_max_sql_text_length")
+	if err != nil {
+		return 0
+	}
+	defer result.Close()
+	n, _ := result.GetInt(0, 0)
+	return int(n)
+}
+
+// isTruncated reports whether sample was cut off by the server. The
+// server stores at most limit bytes of it and marks a cut-off text with
+// a trailing "...".
+func isTruncated(sample string, limit int) bool {
+	return (limit > 0 && len(sample) >= limit) || strings.HasSuffix(sample, "...")
+}
+
+// readDigests returns the digests in ranking order.
+func readDigests(conn *client.Conn, rankBy string) ([]*digestRow, error) {
+	order := "SUM_TIMER_WAIT"
+	if rankBy == RankByRows {
+		order = "SUM_ROWS_EXAMINED"
+	}
+	result, err := conn.Execute(fmt.Sprintf(digestQuery, order))
+	if err != nil {
+		return nil, fmt.Errorf("performance_schema digests: %w", err)
+	}
+	defer result.Close()
+
+	limit := sqlTextLimit(conn)
+	rows := make([]*digestRow, len(result.Values))
+	for i, row := range result.Values {
+		r := &digestRow{
+			schema: string(row[0].AsString()),
+			digest: string(row[1].AsString()),
+			text:   string(row[2].AsString()),
+			sample: string(row[8].AsString()),
+		}
+		r.count, _ = result.GetInt(i, 3)
+		r.sumTimerWait, _ = result.GetUint(i, 4)
+		r.sumLockTime, _ = result.GetUint(i, 5)
+		r.rowsSent, _ = result.GetInt(i, 6)
+		r.rowsExamined, _ = result.GetInt(i, 7)
+		r.truncated = isTruncated(r.sample, limit)
+		rows[i] = r
+	}
+	return rows, nil
+}
+
+// RunDigests ranks the statement digests in performance_schema by total
+// latency or rows examined and profiles the sample text of the top ones.
+// Digests whose sample was truncated, or whose sample the safety check
+// refuses, such as SHOW or SET, are passed over without counting towards
+// top. A final table joins the digest totals with the measured row size.
+func RunDigests(d *dsn.MySQL, rankBy string, top int, opts Options) error {
+	s, err := Open(d, opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	rows, err := readDigests(s.conn, rankBy)
+	if err != nil {
+		return err
+	}
+	var (
+		candidates []*digestRow
+		truncated  int
+		refused    int
+	)
+	for _, r := range rows {
+		if len(candidates) == top {
+			break
+		}
+		if r.truncated {
+			truncated++
+			continue
+		}
+		if checkStatement(r.sample, s.opts) != nil {
+			refused++
+			continue
+		}
+		candidates = append(candidates, r)
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("performance_schema digests: no digest with a runnable sample (%d passed over)", truncated+refused)
+	}
+	if truncated > 0 {
+		fmt.Printf("Passed over %d digests whose samples were truncated.\n", truncated)
+	}
+	if refused > 0 {
+		fmt.Printf("Passed over %d digests whose samples the safety check refuses.\n", refused)
+	}
+	if truncated+refused > 0 {
+		fmt.Println()
+	}
+
+	var (
+		results  []*digestResult
+		timedOut bool
+	)
+	for i, r := range candidates {
+		fmt.Printf("##### Digest %d of %d #####\n\n", i+1, len(candidates))
+		printDigest(r)
+		// Digests without a schema run in the DSN's database, as slow
+		// log samples without one do.
+		rep, err := s.profile(r.db(d.Db()), r.sample)
+		if err != nil {
+			return err
+		}
+		if rep == nil {
+			continue
+		}
+		res := &digestResult{r, rep}
+		printDigestComparison(res)
+		printResults(rep)
+		results = append(results, res)
+		timedOut = timedOut || !rep.outcome.completed
+	}
+	if len(results) > 0 {
+		printDigestPayload(results)
+	}
+	if timedOut {
+		return ErrQueryTimeout
+	}
+	return nil
+}
+
+func printDigest(r *digestRow) {
+	fmt.Println("=== Digest ===")
+	fmt.Printf("  Digest:           %s\n", r.digest)
+	if r.schema != "" {
+		fmt.Printf("  Schema:           %s\n", r.schema)
+	}
+	fmt.Printf("  Digest text:      %s\n", oneLine(r.text, 200))
+	fmt.Printf("  Executions:       %d\n", r.count)
+	fmt.Printf("  Total latency:    %s\n", formatDuration(picoseconds(r.sumTimerWait)))
+	fmt.Printf("  Rows examined:    %d\n", r.rowsExamined)
+	fmt.Printf("  Rows sent:        %d\n", r.rowsSent)
+	fmt.Println()
+}
+
+// printDigestComparison shows the per-execution averages from the digest
+// next to the fresh measurement of its sample.
+func printDigestComparison(res *digestResult) {
+	r, rep := res.row, res.rep
+	n := max(r.count, 1)
+	fmt.Println("=== Historical vs Measured ===")
+	fmt.Printf("  %-15s  %14s  %14s\n", "", "Historical avg", "Measured")
+	fmt.Printf("  %-15s  %14s  %14s\n", "Latency", formatDuration(r.avgLatency()), formatDuration(rep.elapsed))
+	fmt.Printf("  %-15s  %14s  %14s\n", "Lock time", formatDuration(picoseconds(r.sumLockTime/uint64(n))), "-")
+	fmt.Printf("  %-15s  %14d  %14d\n", "Rows sent", r.rowsSent/n, rep.rowsReturned())
+	fmt.Printf("  %-15s  %14d  %14d\n", "Rows examined", r.rowsExamined/n, rep.rowsExamined())
+	fmt.Printf("  %-15s  %14s  %14s\n", "Data size", "-", formatBytes(rep.totalSize()))
+	fmt.Println()
+}
+
+// printDigestPayload ranks the profiled digests by the bytes they are
+// estimated to have shipped: measured bytes per row times the digest's
+// total rows sent.
+func printDigestPayload(results []*digestResult) {
+	sorted := make([]*digestResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].estimatedBytes() > sorted[j].estimatedBytes()
+	})
+
+	fmt.Println("##### Digest Payload #####")
+	fmt.Println()
+	fmt.Printf("  %4s  %10s  %12s  %10s  %10s  %s\n",
+		"Rank", "Execs", "Rows sent", "Row size", "Est. bytes", "Digest text")
+	for i, res := range sorted {
+		fmt.Printf("  %4d  %10d  %12d  %10s  %10s  %s\n", i+1, res.row.count, res.row.rowsSent,
+			formatBytes(res.avgRowSize()), formatBytes(res.estimatedBytes()), oneLine(res.row.text, 60))
+	}
+	fmt.Println()
+}
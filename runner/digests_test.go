@@ -0,0 +1,42 @@
+package runner
+
+import "testing"
+
+func TestDigestRowDB(t *testing.T) {
+	tests := []struct {
+		schema   string
+		fallback string
+		want     string
+	}{
+		{"sales", "test", "sales"},
+		{"sales", "", "sales"},
+		// A statement run without a default database has an empty
+		// SCHEMA_NAME; its sample runs in the DSN's database.
+		{"", "test", "test"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		r := &digestRow{schema: tt.schema, digest: "dd44", sample: "SELECT 1"}
+		if got := r.db(tt.fallback); got != tt.want {
+			t.Errorf("schema %q, fallback %q: db() = %q, want %q", tt.schema, tt.fallback, got, tt.want)
+		}
+	}
+}
+
+func TestIsTruncated(t *testing.T) {
+	tests := []struct {
+		sample string
+		limit  int
+		want   bool
+	}{
+		{"SELECT 1", 1024, false},
+		{"SELECT * FROM t WHERE id IN (1, 2, ...", 1024, true},
+		{"SELECT 1234", 11, true},
+		{"SELECT 1234", 0, false},
+	}
+	for _, tt := range tests {
+		if got := isTruncated(tt.sample, tt.limit); got != tt.want {
+			t.Errorf("isTruncated(%q, %d) = %v, want %v", tt.sample, tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/client"
+
+	"github.com/dbnski/query-stats/statement"
+)
+
+// ErrRollbackIncomplete is returned when the rollback of a --dml-rollback
+// run could not undo everything because a non-transactional table was
+// changed.
+var ErrRollbackIncomplete = errors.New("rollback incomplete")
+
+// errNonTransactional is the warning the server raises on ROLLBACK when a
+// non-transactional table was changed in the transaction.
+const errNonTransactional = 1196
+
+// lockStatusVars are server-wide counters; other sessions may contribute
+// to their deltas.
+var lockStatusVars = []string{
+	"Innodb_row_lock_waits",
+	"Innodb_row_lock_time",
+}
+
+// trxStats describes the open transaction of a --dml-rollback run, taken
+// just before it is rolled back.
+type trxStats struct {
+	available    bool // false when INNODB_TRX has no row for this session
+	rowsModified int64
+	rowsLocked   int64
+	lockStructs  int64
+	lockMemory   int64
+	lockWaits    int64
+	lockTime     int64
+	rolledBack   bool
+}
+
+func getLockStatus(conn *client.Conn) (map[string]int64, error) {
+	r, err := conn.Execute("SHOW GLOBAL STATUS LIKE 'Innodb_row_lock%'")
+	if err != nil {
+		return nil, fmt.Errorf("show global status: %w", err)
+	}
+	status := make(map[string]int64)
+	for _, row := range r.Values {
+		var v int64
+		fmt.Sscan(string(row[1].AsString()), &v)
+		status[string(row[0].AsString())] = v
+	}
+	return status, nil
+}
+
+func captureTrxStats(conn *client.Conn, lockBefore map[string]int64) (*trxStats, error) {
+	t := &trxStats{}
+
+	lockAfter, err := getLockStatus(conn)
+	if err != nil {
+		return nil, err
+	}
+	t.lockWaits = lockAfter[lockStatusVars[0]] - lockBefore[lockStatusVars[0]]
+	t.lockTime = lockAfter[lockStatusVars[1]] - lockBefore[lockStatusVars[1]]
+
+	// trx_rows_modified counts undo log records, which is the closest the
+	// server gets to exposing the undo size of a single transaction.
+	r, err := conn.Execute(`SELECT trx_rows_modified, trx_rows_locked,
+		trx_lock_structs, trx_lock_memory_bytes
+		FROM information_schema.INNODB_TRX
+		WHERE trx_mysql_thread_id = CONNECTION_ID()`)
+	if err != nil {
+		return nil, fmt.Errorf("innodb_trx: %w", err)
+	}
+	if len(r.Values) > 0 {
+		row := r.Values[0]
+		t.available = true
+		t.rowsModified = row[0].AsInt64()
+		t.rowsLocked = row[1].AsInt64()
+		t.lockStructs = row[2].AsInt64()
+		t.lockMemory = row[3].AsInt64()
+	}
+	return t, nil
+}
+
+// checkTransactional refuses query when a table it writes to uses a
+// storage engine without transactions, whose changes the rollback cannot
+// undo. Tables information_schema does not list, such as temporary tables,
+// are left to the warning check after the rollback, as are tables changed
+// by triggers.
+func checkTransactional(conn *client.Conn, query string) error {
+	tables, err := statement.WriteTargets(query)
+	if err != nil || len(tables) == 0 {
+		return nil
+	}
+	conds := make([]string, len(tables))
+	for i, t := range tables {
+		schema := "DATABASE()"
+		if t.Schema != "" {
+			schema = quoteString(t.Schema)
+		}
+		conds[i] = fmt.Sprintf("(t.TABLE_SCHEMA = %s AND t.TABLE_NAME = %s)", schema, quoteString(t.Name))
+	}
+	r, err := conn.Execute(`SELECT t.TABLE_SCHEMA, t.TABLE_NAME, t.ENGINE
+		FROM information_schema.TABLES t
+		JOIN information_schema.ENGINES e ON e.ENGINE = t.ENGINE
+		WHERE e.TRANSACTIONS <> 'YES' AND (` + strings.Join(conds, " OR ") + ")")
+	if err != nil {
+		return fmt.Errorf("storage engines: %w", err)
+	}
+	defer r.Close()
+	if len(r.Values) > 0 {
+		row := r.Values[0]
+		return fmt.Errorf("dml-rollback: %s.%s uses %s, which has no transactions, so changes to it cannot be rolled back",
+			row[0].AsString(), row[1].AsString(), row[2].AsString())
+	}
+	return nil
+}
+
+// rollback rolls back the transaction and fails with ErrRollbackIncomplete
+// if the server warns that some of its changes stay in place.
+func rollback(conn *client.Conn) error {
+	if err := conn.Rollback(); err != nil {
+		return fmt.Errorf("rollback: %w", err)
+	}
+	r, err := conn.Execute("SHOW WARNINGS")
+	if err != nil {
+		return fmt.Errorf("show warnings: %w", err)
+	}
+	defer r.Close()
+	for _, row := range r.Values {
+		if row[1].AsInt64() == errNonTransactional {
+			return fmt.Errorf("%w: %s (warning %d)",
+				ErrRollbackIncomplete, row[2].AsString(), errNonTransactional)
+		}
+	}
+	return nil
+}
+
+func printTrxStats(t *trxStats) {
+	fmt.Println("=== Transaction ===")
+	if t.available {
+		fmt.Printf("  Undo records:     %s\n", formatInt(t.rowsModified))
+		fmt.Printf("  Rows locked:      %s\n", formatInt(t.rowsLocked))
+		fmt.Printf("  Lock structs:     %s\n", formatInt(t.lockStructs))
+		fmt.Printf("  Lock memory:      %s\n", formatBytes(t.lockMemory))
+	} else {
+		fmt.Println("  InnoDB transaction details not available")
+	}
+	fmt.Printf("  Row lock waits:   %s (server-wide)\n", formatInt(t.lockWaits))
+	fmt.Printf("  Row lock time:    %s ms (server-wide)\n", formatInt(t.lockTime))
+	if t.rolledBack {
+		fmt.Println("  Rolled back:      yes")
+	}
+	fmt.Println()
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/go-mysql-org/go-mysql/client"
+
+	"github.com/dbnski/query-stats/statement"
+)
+
+// fingerprint identifies a query by its normalised form, so reports of
+// queries that differ only in their literals can be joined.
+type fingerprint struct {
+	normalized string
+	digest     string // SHA-256 of normalized
+	// server* are the server's own STATEMENT_DIGEST() and
+	// STATEMENT_DIGEST_TEXT(), the values performance_schema and the
+	// sys schema use. They are empty where the server cannot compute them.
+	serverDigest string
+	serverText   string
+}
+
+// getFingerprint normalises query locally and, on MySQL 8.0.4 or later,
+// asks the server for its digest as well. The server digest hashes the
+// server's own token stream, so it cannot be reproduced client-side; any
+// error computing it (older servers, MariaDB, TiDB, text the server does
+// not parse as a single statement) just leaves it out.
+func getFingerprint(conn *client.Conn, ctx *serverContext, query string) *fingerprint {
+	fp := &fingerprint{}
+	fp.normalized, fp.digest = statement.Fingerprint(query)
+	if ctx == nil || (ctx.flavour != "MySQL" && ctx.flavour != "Percona Server") {
+		return fp
+	}
+	result, err := conn.Execute("SELECT STATEMENT_DIGEST(?), STATEMENT_DIGEST_TEXT(?)", query, query)
+	if err != nil {
+		return fp
+	}
+	defer result.Close()
+	if len(result.Values) > 0 {
+		row := result.Values[0]
+		fp.serverDigest = string(row[0].AsString())
+		fp.serverText = string(row[1].AsString())
+	}
+	return fp
+}
+
+func printFingerprint(fp *fingerprint) {
+	fmt.Println("=== Fingerprint ===")
+	fmt.Printf("  Digest:           %s\n", fp.digest)
+	fmt.Printf("  Normalized:       %s\n", oneLine(fp.normalized, 200))
+	if fp.serverDigest != "" {
+		fmt.Printf("  Server digest:    %s\n", fp.serverDigest)
+		fmt.Printf("  Server text:      %s\n", oneLine(fp.serverText, 200))
+	}
+	fmt.Println()
+}
@@ -0,0 +1,592 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+
+	"github.com/dbnski/query-stats/dsn"
+)
+
+// Server error codes counted separately under load.
+const (
+	errLockWaitTimeout = 1205 // ER_LOCK_WAIT_TIMEOUT
+	errDeadlock        = 1213 // ER_LOCK_DEADLOCK
+)
+
+// LoadOptions controls a run from several connections at once.
+type LoadOptions struct {
+	Concurrency int           // number of connections
+	Duration    time.Duration // how long to run
+	QPS         float64       // target rate over all connections; 0 runs back to back
+}
+
+// latencies is a set of execution times that can be summarised.
+type latencies []time.Duration
+
+// sorted returns a sorted copy.
+func (l latencies) sorted() latencies {
+	s := make(latencies, len(l))
+	copy(s, l)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s
+}
+
+// percentile returns the nearest-rank p-th percentile of a sorted set.
+func (l latencies) percentile(p float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	i := int(p/100*float64(len(l))+0.5) - 1
+	return l[min(max(i, 0), len(l)-1)]
+}
+
+// execStats is what a set of executions under load saw.
+type execStats struct {
+	latencies    latencies // successful executions only
+	rows, bytes  int64
+	errors       map[string]int64
+	errorCount   int64
+	deadlocks    int64
+	lockTimeouts int64
+	timeouts     int64
+}
+
+func newExecStats() *execStats {
+	return &execStats{errors: make(map[string]int64)}
+}
+
+// merge adds the executions in o to s.
+func (s *execStats) merge(o *execStats) {
+	s.latencies = append(s.latencies, o.latencies...)
+	s.rows += o.rows
+	s.bytes += o.bytes
+	for msg, n := range o.errors {
+		s.errors[msg] += n
+	}
+	s.errorCount += o.errorCount
+	s.deadlocks += o.deadlocks
+	s.lockTimeouts += o.lockTimeouts
+	s.timeouts += o.timeouts
+}
+
+// fail counts a server error and returns nil, or returns err when it did
+// not come from the server.
+func (s *execStats) fail(err error) error {
+	var myErr *mysql.MyError
+	if !errors.As(err, &myErr) {
+		return err
+	}
+	switch {
+	case isTimeoutError(err):
+		s.timeouts++
+		return nil
+	case myErr.Code == errDeadlock:
+		s.deadlocks++
+	case myErr.Code == errLockWaitTimeout:
+		s.lockTimeouts++
+	}
+	s.errorCount++
+	s.errors[myErr.Error()]++
+	return nil
+}
+
+// loadQuery is one of the queries a load run picks from.
+type loadQuery struct {
+	name   string
+	text   string
+	weight float64
+	params []paramGen // values for ? placeholders; nil sends text as is
+	fp     *fingerprint
+}
+
+// args generates one row of parameter values.
+func (q *loadQuery) args() []any {
+	args := make([]any, len(q.params))
+	for i, p := range q.params {
+		args[i] = p.next()
+	}
+	return args
+}
+
+// picker returns a function that picks a query index at random in
+// proportion to the weights.
+func picker(queries []*loadQuery) func() int {
+	if len(queries) == 1 {
+		return func() int { return 0 }
+	}
+	cum := make([]float64, len(queries))
+	total := 0.0
+	for i, q := range queries {
+		total += q.weight
+		cum[i] = total
+	}
+	return func() int {
+		return min(sort.SearchFloat64s(cum, rand.Float64()*total), len(cum)-1)
+	}
+}
+
+// loadWorker is one connection of a load run and what it saw.
+type loadWorker struct {
+	conn  *client.Conn
+	steps [][]step       // per query sent as text
+	stmts []*client.Stmt // per query with parameters
+	stats []*execStats   // per query
+
+	before map[string]int64
+	after  map[string]int64
+	err    error // connection failure that stopped the worker
+}
+
+// openWorker connects and sets up the session exactly like a single run,
+// then prepares the queries that take parameters.
+func openWorker(d *dsn.MySQL, queries []*loadQuery, opts Options) (*loadWorker, []varValue, error) {
+	conn, err := connect(d, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := &loadWorker{
+		conn:  conn,
+		steps: make([][]step, len(queries)),
+		stmts: make([]*client.Stmt, len(queries)),
+		stats: make([]*execStats, len(queries)),
+	}
+	vars, err := setupSession(conn, opts)
+	if err != nil {
+		w.close()
+		return nil, nil, err
+	}
+	for i, q := range queries {
+		w.stats[i] = newExecStats()
+		if q.params == nil {
+			if w.steps[i], err = buildSteps(conn, q.text, opts); err != nil {
+				w.close()
+				return nil, nil, fmt.Errorf("%s: %w", q.name, err)
+			}
+			continue
+		}
+		stmt, err := conn.Prepare(q.text)
+		if err != nil {
+			w.close()
+			return nil, nil, fmt.Errorf("%s: prepare: %w", q.name, err)
+		}
+		w.stmts[i] = stmt
+		if stmt.ParamNum() != len(q.params) {
+			w.close()
+			return nil, nil, fmt.Errorf("%s: query has %d placeholders, got %d params",
+				q.name, stmt.ParamNum(), len(q.params))
+		}
+	}
+	return w, vars, nil
+}
+
+func (w *loadWorker) close() {
+	for _, stmt := range w.stmts {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	w.conn.Close()
+}
+
+// total returns the executions of every query on this connection.
+func (w *loadWorker) total() *execStats {
+	t := newExecStats()
+	for _, s := range w.stats {
+		t.merge(s)
+	}
+	return t
+}
+
+// run executes queries until stop is closed: the ones sent on jobs, or,
+// with no jobs channel, back to back as chosen by pick. Session status is
+// only read at the start and at the end, so the snapshots do not add round
+// trips between executions.
+func (w *loadWorker) run(queries []*loadQuery, opts Options, pick func() int, jobs <-chan int, stop <-chan struct{}) {
+	var err error
+	if w.before, err = getSessionStatus(w.conn); err != nil {
+		w.err = err
+		return
+	}
+	for {
+		var i int
+		if jobs == nil {
+			select {
+			case <-stop:
+				w.after, w.err = getSessionStatus(w.conn)
+				return
+			default:
+				i = pick()
+			}
+		} else {
+			select {
+			case <-stop:
+				w.after, w.err = getSessionStatus(w.conn)
+				return
+			case i = <-jobs:
+			}
+		}
+		if err := w.runOnce(queries[i], i, opts); err != nil {
+			w.err = err
+			return
+		}
+	}
+}
+
+// runOnce executes query i once, in its own transaction unless
+// --allow-writes is given. Server errors are counted and the worker moves
+// on; any other error means the connection is gone and is returned.
+func (w *loadWorker) runOnce(q *loadQuery, i int, opts Options) error {
+	stats := w.stats[i]
+	steps := w.steps[i]
+	if stmt := w.stmts[i]; stmt != nil {
+		steps = []step{stmtStep(stmt, q.text, q.args())}
+	}
+
+	inTrx := opts.DMLRollback || !opts.AllowWrites
+	if inTrx {
+		if err := w.conn.BeginTx(!opts.DMLRollback, ""); err != nil {
+			return stats.fail(fmt.Errorf("start transaction: %w", err))
+		}
+	}
+
+	c := &collector{binaryMode: opts.BinaryMode}
+	resetWatch(w.conn)
+	start := time.Now()
+	var err error
+	for _, st := range steps {
+		if err = st.exec(c); err != nil {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+
+	if inTrx {
+		var rbErr error
+		if opts.DMLRollback {
+			rbErr = rollback(w.conn)
+		} else {
+			rbErr = w.conn.Rollback()
+		}
+		if rbErr != nil && err == nil {
+			err = rbErr
+		}
+	}
+	if err != nil {
+		return stats.fail(fmt.Errorf("query: %w", classifyError(err, w.conn)))
+	}
+	stats.latencies = append(stats.latencies, elapsed)
+	for _, r := range c.results {
+		stats.rows += r.rowCount
+		stats.bytes += r.totalSize
+	}
+	return nil
+}
+
+// loadRun is the outcome of a load run.
+type loadRun struct {
+	info       *connInfo
+	context    *serverContext
+	workers    []*loadWorker
+	elapsed    time.Duration
+	missed     int64 // scheduled executions no connection was free for
+	lockBefore map[string]int64
+	lockAfter  map[string]int64
+}
+
+// runLoad opens lo.Concurrency connections with the same session setup
+// and runs queries from all of them for lo.Duration. With lo.QPS set,
+// executions are started on a fixed schedule instead of back to back.
+// An interrupt stops the run early; the outcome covers what ran until then.
+func runLoad(d *dsn.MySQL, queries []*loadQuery, lo LoadOptions, opts Options) (*loadRun, error) {
+	workers := make([]*loadWorker, 0, lo.Concurrency)
+	defer func() {
+		for _, w := range workers {
+			w.close()
+		}
+	}()
+	var vars []varValue
+	for i := 0; i < lo.Concurrency; i++ {
+		w, v, err := openWorker(d, queries, opts)
+		if err != nil {
+			return nil, fmt.Errorf("connection %d: %w", i+1, err)
+		}
+		workers = append(workers, w)
+		if i == 0 {
+			vars = v
+		}
+	}
+
+	first := workers[0].conn
+	ctx, err := getServerContext(first, vars)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		if opts.DMLRollback {
+			if err := checkTransactional(first, q.text); err != nil {
+				return nil, err
+			}
+		}
+		q.fp = getFingerprint(first, ctx, q.text)
+	}
+	r := &loadRun{
+		info:    getConnInfo(first, d),
+		context: ctx,
+		workers: workers,
+	}
+	if r.lockBefore, err = getLockStatus(first); err != nil {
+		return nil, err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var (
+		pick   = picker(queries)
+		stop   = make(chan struct{})
+		jobs   chan int
+		missed atomic.Int64
+		wg     sync.WaitGroup
+	)
+	start := time.Now()
+	if lo.QPS > 0 {
+		jobs = make(chan int, lo.Concurrency)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			schedule(lo.QPS, stop, func() {
+				select {
+				case jobs <- pick():
+				default:
+					missed.Add(1)
+				}
+			})
+		}()
+	}
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(queries, opts, pick, jobs, stop)
+		}()
+	}
+	select {
+	case <-time.After(lo.Duration):
+	case <-interrupt:
+		fmt.Fprintln(os.Stderr, "Interrupted, waiting for running queries to finish")
+	}
+	close(stop)
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	r.missed = missed.Load()
+
+	// The first connection may have been lost during the run, in which
+	// case the lock counters are left out.
+	r.lockAfter, _ = getLockStatus(first)
+	return r, nil
+}
+
+// schedule calls fn qps times a second until stop is closed. After a
+// stall it catches up rather than skipping ticks.
+func schedule(qps float64, stop <-chan struct{}, fn func()) {
+	interval := time.Duration(float64(time.Second) / qps)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	next := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+		for now := time.Now(); !next.After(now); next = next.Add(interval) {
+			fn()
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// status returns the error the run should exit with: a network error or
+// an incomplete rollback that stopped a connection, the error that stopped
+// the last one when every connection was lost, or ErrQueryTimeout if any
+// execution timed out.
+func (r *loadRun) status() error {
+	var (
+		timedOut bool
+		lost     int
+		lastErr  error
+	)
+	for _, w := range r.workers {
+		if w.err != nil && (IsNetworkError(w.err) || errors.Is(w.err, ErrRollbackIncomplete)) {
+			return w.err
+		}
+		if w.err != nil {
+			lost++
+			lastErr = w.err
+		}
+		for _, s := range w.stats {
+			timedOut = timedOut || s.timeouts > 0
+		}
+	}
+	if lost == len(r.workers) {
+		return fmt.Errorf("every connection was lost: %w", lastErr)
+	}
+	if timedOut {
+		return ErrQueryTimeout
+	}
+	return nil
+}
+
+// RunLoad runs query from several connections at once and reports
+// throughput, latency per connection, errors and the summed session status
+// deltas.
+func RunLoad(d *dsn.MySQL, query string, lo LoadOptions, opts Options) error {
+	if err := checkStatement(query, opts); err != nil {
+		return err
+	}
+	queries := []*loadQuery{{name: "query", text: query, weight: 1}}
+	r, err := runLoad(d, queries, lo, opts)
+	if err != nil {
+		return err
+	}
+
+	printConnInfo(r.info)
+	printServerContext(r.context)
+	if opts.EchoQuery {
+		printQueryText(query)
+	}
+	printFingerprint(queries[0].fp)
+	printLoad(r, lo, nil)
+	return r.status()
+}
+
+// printLoad prints the Load section and what follows it. Latency is broken
+// down by connection, or by query when queries is given.
+func printLoad(r *loadRun, lo LoadOptions, queries []*loadQuery) {
+	var (
+		total       = newExecStats()
+		failed      int
+		statusDelta = make(map[string]int64)
+	)
+	for _, w := range r.workers {
+		total.merge(w.total())
+		if w.err != nil {
+			failed++
+		}
+		if w.before != nil && w.after != nil {
+			for name, v := range w.after {
+				statusDelta[name] += v - w.before[name]
+			}
+		}
+	}
+	perSec := func(n int64) float64 {
+		return float64(n) / r.elapsed.Seconds()
+	}
+	executions := int64(len(total.latencies))
+
+	fmt.Println("=== Load ===")
+	fmt.Printf("  Connections:      %d", len(r.workers))
+	if failed > 0 {
+		fmt.Printf(" (%d lost)", failed)
+	}
+	fmt.Println()
+	fmt.Printf("  Duration:         %s\n", formatDuration(r.elapsed))
+	if lo.QPS > 0 {
+		fmt.Printf("  Target rate:      %.1f/s", lo.QPS)
+		if r.missed > 0 {
+			fmt.Printf(" (%s missed, every connection busy)", formatInt(r.missed))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("  Queries:          %s (%.1f/s)\n", formatInt(executions), perSec(executions))
+	fmt.Printf("  Rows returned:    %s (%.1f/s)\n", formatInt(total.rows), perSec(total.rows))
+	fmt.Printf("  Data returned:    %s (%s/s)\n", formatBytes(total.bytes), formatBytes(int64(perSec(total.bytes))))
+	fmt.Printf("  Errors:           %s\n", formatInt(total.errorCount))
+	fmt.Printf("  Deadlocks:        %s\n", formatInt(total.deadlocks))
+	fmt.Printf("  Lock timeouts:    %s\n", formatInt(total.lockTimeouts))
+	if total.timeouts > 0 {
+		fmt.Printf("  Timed out:        %s\n", formatInt(total.timeouts))
+	}
+	if r.lockAfter != nil {
+		fmt.Printf("  Row lock waits:   %s (%s ms waited, server-wide)\n",
+			formatInt(r.lockAfter[lockStatusVars[0]]-r.lockBefore[lockStatusVars[0]]),
+			formatInt(r.lockAfter[lockStatusVars[1]]-r.lockBefore[lockStatusVars[1]]))
+	}
+	fmt.Println()
+
+	if queries == nil {
+		fmt.Println("=== Latency ===")
+		printLatencyHeader("Connection", 10)
+		for i, w := range r.workers {
+			printLatencyRow(fmt.Sprint(i+1), 10, w.total())
+		}
+		if len(r.workers) > 1 {
+			printLatencyRow("All", 10, total)
+		}
+		fmt.Println()
+	} else {
+		printQueryBreakdown(r, queries, total)
+	}
+
+	if len(total.errors) > 0 {
+		printErrorCounts(total.errors)
+	}
+	for i, w := range r.workers {
+		if w.err != nil {
+			fmt.Printf("  Connection %d stopped: %v\n", i+1, w.err)
+		}
+	}
+	if failed > 0 {
+		fmt.Println()
+	}
+
+	printSessionStatus(map[string]int64{}, statusDelta)
+}
+
+func printLatencyHeader(label string, width int) {
+	fmt.Printf("  %-*s  %8s  %6s  %10s  %10s  %10s  %10s  %10s\n",
+		width, label, "Queries", "Errors", "Min", "p50", "p95", "p99", "Max")
+}
+
+func printLatencyRow(label string, width int, stats *execStats) {
+	if len(stats.latencies) == 0 {
+		fmt.Printf("  %-*s  %8d  %6d  %10s  %10s  %10s  %10s  %10s\n",
+			width, label, 0, stats.errorCount, "-", "-", "-", "-", "-")
+		return
+	}
+	s := stats.latencies.sorted()
+	fmt.Printf("  %-*s  %8d  %6d  %10s  %10s  %10s  %10s  %10s\n",
+		width, label, len(s), stats.errorCount, formatDuration(s[0]), formatDuration(s.percentile(50)),
+		formatDuration(s.percentile(95)), formatDuration(s.percentile(99)), formatDuration(s[len(s)-1]))
+}
+
+// printErrorCounts lists distinct errors, most frequent first.
+func printErrorCounts(counts map[string]int64) {
+	msgs := make([]string, 0, len(counts))
+	for msg := range counts {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		if counts[msgs[i]] != counts[msgs[j]] {
+			return counts[msgs[i]] > counts[msgs[j]]
+		}
+		return msgs[i] < msgs[j]
+	})
+	fmt.Println("=== Errors ===")
+	for _, msg := range msgs {
+		fmt.Printf("  %8d  %s\n", counts[msg], oneLine(strings.TrimSpace(msg), 120))
+	}
+	fmt.Println()
+}
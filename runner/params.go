@@ -0,0 +1,322 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// ParseParam converts a textual value, from --param, a CSV params file or
+// --set-var, into the value bound to a placeholder. Integers and floats are
+// bound as numbers so that they compare against numeric columns without a
+// conversion, true and false in any case as booleans, as they are in a JSON
+// params file, \N as NULL and anything else as a string.
+func ParseParam(s string) any {
+	switch {
+	case s == `\N`:
+		return nil
+	case strings.EqualFold(s, "true"):
+		return true
+	case strings.EqualFold(s, "false"):
+		return false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// LoadParams reads parameter rows from a .json or .csv file. A JSON file
+// holds an array of rows, each row an array of values; a plain array of
+// scalars is read as one single-value row per element. A CSV file holds one
+// row per record.
+func LoadParams(path string) ([][]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("params file: %w", err)
+	}
+	var rows [][]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		rows, err = parseJSONParams(data)
+	case ".csv":
+		rows, err = parseCSVParams(data)
+	default:
+		return nil, fmt.Errorf("params file: unsupported format %q (use .json or .csv)", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("params file: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("params file: no parameter rows in %s", path)
+	}
+	return rows, nil
+}
+
+func parseJSONParams(data []byte) ([][]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw []any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	rows := make([][]any, len(raw))
+	for i, r := range raw {
+		values, ok := r.([]any)
+		if !ok {
+			values = []any{r}
+		}
+		row := make([]any, len(values))
+		for j, v := range values {
+			bv, err := jsonParam(v)
+			if err != nil {
+				return nil, fmt.Errorf("row %d, value %d: %w", i+1, j+1, err)
+			}
+			row[j] = bv
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+func jsonParam(v any) (any, error) {
+	switch val := v.(type) {
+	case nil, string, bool:
+		return val, nil
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, nil
+		}
+		return val.Float64()
+	default:
+		return nil, fmt.Errorf("unsupported value %v", val)
+	}
+}
+
+func parseCSVParams(data []byte) ([][]any, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([][]any, len(records))
+	for i, rec := range records {
+		row := make([]any, len(rec))
+		for j, v := range rec {
+			row[j] = ParseParam(v)
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// stmtStep executes a prepared statement with args bound and streams its
+// result set.
+func stmtStep(stmt *client.Stmt, text string, args []any) step {
+	return step{
+		text: text,
+		exec: func(c *collector) error {
+			return c.stream(func(result *mysql.Result, perRow client.SelectPerRowCallback) error {
+				return stmt.ExecuteSelectStreaming(result, perRow, nil, args...)
+			})
+		},
+	}
+}
+
+// runPrepared executes query as a prepared statement once per parameter row,
+// printing a report for each binding and, for more than one, an aggregate.
+func runPrepared(conn *client.Conn, info *connInfo, ctx *serverContext, query string, opts Options) error {
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, row := range opts.Params {
+		if len(row) != stmt.ParamNum() {
+			return fmt.Errorf("parameter row %d: query has %d placeholders, got %d values",
+				i+1, stmt.ParamNum(), len(row))
+		}
+	}
+
+	var (
+		reports  []*report
+		timedOut bool
+		fp       = getFingerprint(conn, ctx, query)
+	)
+	for i, row := range opts.Params {
+		rep, err := measure(conn, opts, stmtStep(stmt, query, row))
+		if err != nil {
+			return fmt.Errorf("parameter row %d: %w", i+1, err)
+		}
+		rep.params = row
+		rep.text = query
+		rep.fp = fp
+		rep.showText = opts.EchoQuery && i == 0
+		if i == 0 {
+			rep.conn = info
+			rep.context = ctx
+		}
+		if len(opts.Params) > 1 {
+			fmt.Printf("##### Binding %d of %d #####\n\n", i+1, len(opts.Params))
+		}
+		printResults(rep)
+		reports = append(reports, rep)
+		timedOut = timedOut || !rep.outcome.completed
+	}
+
+	if len(reports) > 1 {
+		printAggregate(reports, "bindings")
+	}
+	if timedOut {
+		return ErrQueryTimeout
+	}
+	return nil
+}
+
+func formatParam(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func printParams(params []any) {
+	fmt.Println("=== Parameters ===")
+	for i, p := range params {
+		fmt.Printf("  ?%-3d %s\n", i+1, formatParam(p))
+	}
+	fmt.Println()
+}
+
+// mergeColStats folds src into dst. Both must describe the same columns.
+func mergeColStats(dst, src []colStats) {
+	for i := range dst {
+		if i >= len(src) {
+			break
+		}
+		if src[i].count > 0 {
+			if src[i].minLen < dst[i].minLen {
+				dst[i].minLen = src[i].minLen
+			}
+			if src[i].maxLen > dst[i].maxLen {
+				dst[i].maxLen = src[i].maxLen
+			}
+		}
+		dst[i].sumLen += src[i].sumLen
+		dst[i].count += src[i].count
+		dst[i].nullCount += src[i].nullCount
+		dst[i].emptyCount += src[i].emptyCount
+	}
+}
+
+// resultAggregate sums one result set position over several runs.
+type resultAggregate struct {
+	runs    int64
+	minRows int64
+	maxRows int64
+	sumRows int64
+	sumSize int64
+	cols    []colStats
+}
+
+func (a *resultAggregate) add(r *resultStats) {
+	if a.runs == 0 || r.rowCount < a.minRows {
+		a.minRows = r.rowCount
+	}
+	a.maxRows = max(a.maxRows, r.rowCount)
+	a.sumRows += r.rowCount
+	a.sumSize += r.totalSize
+	a.runs++
+	if r.cols != nil {
+		if a.cols == nil {
+			a.cols = make([]colStats, len(r.cols))
+			copy(a.cols, r.cols)
+		} else {
+			mergeColStats(a.cols, r.cols)
+		}
+	}
+}
+
+// printAggregate summarises several runs of the same query; noun names
+// what was repeated, such as "bindings". Result sets are aggregated by
+// position, so a query that returns several is summarised per result set.
+func printAggregate(reports []*report, noun string) {
+	var (
+		minElapsed  time.Duration = math.MaxInt64
+		maxElapsed  time.Duration
+		sumElapsed  time.Duration
+		timeouts    int
+		sets        []*resultAggregate
+		statusDelta = make(map[string]int64)
+	)
+	for _, rep := range reports {
+		sumElapsed += rep.elapsed
+		minElapsed = min(minElapsed, rep.elapsed)
+		maxElapsed = max(maxElapsed, rep.elapsed)
+
+		if !rep.outcome.completed {
+			timeouts++
+		}
+		for name, v := range rep.after {
+			statusDelta[name] += v - rep.before[name]
+		}
+		for i, r := range rep.results {
+			if i == len(sets) {
+				sets = append(sets, &resultAggregate{})
+			}
+			sets[i].add(r)
+		}
+	}
+	n := int64(len(reports))
+
+	fmt.Printf("##### Aggregate over %d %s #####\n\n", n, noun)
+	if fp := reports[0].fp; fp != nil {
+		printFingerprint(fp)
+	}
+	fmt.Println("=== Query Execution ===")
+	fmt.Printf("  Execution time:   min %s, avg %s, max %s\n",
+		formatDuration(minElapsed), formatDuration(sumElapsed/time.Duration(n)), formatDuration(maxElapsed))
+	fmt.Printf("  Total time:       %s\n", formatDuration(sumElapsed))
+	if timeouts > 0 {
+		fmt.Printf("  Timed out:        %d\n", timeouts)
+	}
+	fmt.Println()
+
+	printSessionStatus(map[string]int64{}, statusDelta)
+
+	for i, a := range sets {
+		label := ""
+		if len(sets) > 1 {
+			label = fmt.Sprintf(" (result set %d of %d)", i+1, len(sets))
+		}
+		fmt.Printf("=== Result Summary%s ===\n", label)
+		if a.runs < n {
+			fmt.Printf("  Returned by:      %d of %d %s\n", a.runs, n, noun)
+		}
+		fmt.Printf("  Rows returned:    min %s, avg %s, max %s\n",
+			formatInt(a.minRows), formatInt(a.sumRows/a.runs), formatInt(a.maxRows))
+		fmt.Printf("  Total rows:       %s\n", formatInt(a.sumRows))
+		fmt.Printf("  Total data size:  %s\n", formatBytes(a.sumSize))
+		fmt.Println()
+
+		printColumnStats(a.cols, label)
+	}
+}
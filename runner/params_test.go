@@ -0,0 +1,56 @@
+package runner
+
+import "testing"
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{"42", int64(42)},
+		{"-7", int64(-7)},
+		{"1.5", 1.5},
+		{"1e3", 1000.0},
+		{"true", true},
+		{"FALSE", false},
+		{`\N`, nil},
+		{"open", "open"},
+		// Only true and false are booleans; "1" is a number and "t" text.
+		{"1", int64(1)},
+		{"t", "t"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ParseParam(tt.in); got != tt.want {
+			t.Errorf("ParseParam(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResultAggregate(t *testing.T) {
+	var a resultAggregate
+	a.add(&resultStats{
+		cols:      []colStats{{name: "a", minLen: 2, maxLen: 4, sumLen: 6, count: 2}},
+		rowCount:  2,
+		totalSize: 10,
+	})
+	a.add(&resultStats{
+		cols:      []colStats{{name: "a", minLen: 1, maxLen: 3, sumLen: 4, count: 2, nullCount: 1}},
+		rowCount:  3,
+		totalSize: 7,
+	})
+	if a.runs != 2 || a.minRows != 2 || a.maxRows != 3 || a.sumRows != 5 || a.sumSize != 17 {
+		t.Errorf("got runs %d, rows min %d max %d sum %d, size %d; want 2, 2, 3, 5, 17",
+			a.runs, a.minRows, a.maxRows, a.sumRows, a.sumSize)
+	}
+	c := a.cols[0]
+	if c.minLen != 1 || c.maxLen != 4 || c.sumLen != 10 || c.count != 4 || c.nullCount != 1 {
+		t.Errorf("merged column stats = %+v", c)
+	}
+
+	// A run that returned no rows sets the minimum to 0.
+	a.add(&resultStats{})
+	if a.minRows != 0 || a.runs != 3 {
+		t.Errorf("after an empty result: min rows %d, runs %d; want 0, 3", a.minRows, a.runs)
+	}
+}
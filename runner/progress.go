@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// progressDelay keeps the line away from queries that finish quickly.
+	progressDelay = 500 * time.Millisecond
+	// progressInterval is how often the line is redrawn.
+	progressInterval = 200 * time.Millisecond
+)
+
+// progress draws a live status line while a result set streams in. The
+// row callback only stores two counters; the line is drawn from its own
+// goroutine, so the measured time is barely affected.
+type progress struct {
+	out   io.Writer
+	start time.Time
+	rows  atomic.Int64
+	bytes atomic.Int64
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func startProgress(out io.Writer) *progress {
+	p := &progress{
+		out:   out,
+		start: time.Now(),
+		done:  make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.loop()
+	return p
+}
+
+// update records the rows and bytes read so far.
+func (p *progress) update(rows, bytes int64) {
+	p.rows.Store(rows)
+	p.bytes.Store(bytes)
+}
+
+// stop removes the line, if it was drawn, and returns once it is gone.
+func (p *progress) stop() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+func (p *progress) loop() {
+	defer p.wg.Done()
+	select {
+	case <-p.done:
+		return
+	case <-time.After(progressDelay):
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	lastRows, lastTime := int64(0), p.start
+	for {
+		now := time.Now()
+		rows := p.rows.Load()
+		rate := float64(rows-lastRows) / now.Sub(lastTime).Seconds()
+		fmt.Fprintf(p.out, "\r\033[K  %s rows, %s, %s, %.0f rows/s",
+			formatInt(rows), formatBytes(p.bytes.Load()), formatDuration(now.Sub(p.start)), rate)
+		lastRows, lastTime = rows, now
+
+		select {
+		case <-p.done:
+			fmt.Fprint(p.out, "\r\033[K")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package runner
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"math"
 	"net/url"
-	"strconv"
+	"os"
 	"strings"
 	"time"
 
@@ -12,8 +14,33 @@ import (
 	"github.com/go-mysql-org/go-mysql/mysql"
 
 	"github.com/dbnski/query-stats/dsn"
+	"github.com/dbnski/query-stats/statement"
 )
 
+// Server error codes returned when a statement exceeds its execution time limit.
+const (
+	errQueryTimeout     = 3024 // MySQL ER_QUERY_TIMEOUT
+	errStatementTimeout = 1969 // MariaDB ER_STATEMENT_TIMEOUT
+)
+
+// ErrQueryTimeout is returned by Run after reporting a query that was aborted
+// by the server because it exceeded --max-execution-time.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// Options controls how a query is executed and measured.
+type Options struct {
+	SetVars          []string
+	BinaryMode       bool
+	MaxExecutionTime time.Duration
+	AllowWrites      bool
+	DMLRollback      bool
+	Params           [][]any // one row of bound values per execution
+	SplitStatements  bool
+	InitCommands     []string // setup SQL run before measuring, not safety-checked
+	EchoQuery        bool     // print the query text, e.g. after template rendering
+	Progress         bool     // draw a progress line on stderr while rows stream in
+}
+
 type statusGroup struct {
 	title string
 	vars  []string
@@ -32,6 +59,14 @@ var statusGroups = []statusGroup{
 			"Handler_read_rnd_next",
 		},
 	},
+	{
+		title: "Rows Modified",
+		vars: []string{
+			"Handler_delete",
+			"Handler_update",
+			"Handler_write",
+		},
+	},
 	{
 		title: "Temp Tables",
 		vars: []string{
@@ -91,19 +126,6 @@ func getSessionStatus(conn *client.Conn) (map[string]int64, error) {
 	return status, nil
 }
 
-func parseValue(s string) interface{} {
-	if b, err := strconv.ParseBool(s); err == nil {
-		return b
-	}
-	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
-		return i
-	}
-	if f, err := strconv.ParseFloat(s, 64); err == nil {
-		return f
-	}
-	return s
-}
-
 func valueBytes(v interface{}) []byte {
 	switch val := v.(type) {
 	case []byte:
@@ -115,20 +137,37 @@ func valueBytes(v interface{}) []byte {
 	}
 }
 
-func setSessionVars(conn *client.Conn, vars []string) error {
-	for _, v := range vars {
-		idx := strings.IndexByte(v, '=')
-		if idx < 1 || idx == len(v)-1 {
-			return fmt.Errorf("--set-var: expected name=value, got '%q'", v)
-		}
-		name, value := v[:idx], v[idx+1:]
-		if _, err := conn.Execute(fmt.Sprintf("SET SESSION `%s` = ?", name), parseValue(value)); err != nil {
-			return fmt.Errorf("set-var %s: %w", name, err)
-		}
+func isMariaDB(conn *client.Conn) bool {
+	return strings.Contains(strings.ToLower(conn.GetServerVersion()), "mariadb")
+}
+
+// setMaxExecutionTime installs a server-side statement time limit. MySQL
+// takes max_execution_time in milliseconds, MariaDB takes max_statement_time
+// in seconds.
+func setMaxExecutionTime(conn *client.Conn, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	var stmt string
+	if isMariaDB(conn) {
+		stmt = fmt.Sprintf("SET SESSION max_statement_time = %g", d.Seconds())
+	} else {
+		stmt = fmt.Sprintf("SET SESSION max_execution_time = %d", d.Milliseconds())
+	}
+	if _, err := conn.Execute(stmt); err != nil {
+		return fmt.Errorf("max-execution-time: %w", err)
 	}
 	return nil
 }
 
+func isTimeoutError(err error) bool {
+	var myErr *mysql.MyError
+	if !errors.As(err, &myErr) {
+		return false
+	}
+	return myErr.Code == errQueryTimeout || myErr.Code == errStatementTimeout
+}
+
 func fieldTypeName(t byte) string {
 	switch t {
 	case mysql.MYSQL_TYPE_DECIMAL:
@@ -264,12 +303,18 @@ func initColStats(fields []*mysql.Field) []colStats {
 	return s
 }
 
-func connOptions(opts url.Values) []client.Option {
+// connOptions returns the client options for opts. multi turns on the
+// capabilities batches of statements and CALL need. It is only set for a
+// query that is one of those: with them on, any text the safety check and
+// the server split differently would run unchecked statements.
+func connOptions(opts url.Values, multi bool) []client.Option {
 	var out []client.Option
-	if _, ok := opts["ssl"]; ok {
+	if multi {
 		out = append(out, func(c *client.Conn) error {
-			c.UseSSL(true)
-			return nil
+			if err := c.SetCapability(mysql.CLIENT_MULTI_STATEMENTS); err != nil {
+				return err
+			}
+			return c.SetCapability(mysql.CLIENT_MULTI_RESULTS)
 		})
 	}
 	if vals, ok := opts["collation"]; ok && len(vals) > 0 {
@@ -281,99 +326,544 @@ func connOptions(opts url.Values) []client.Option {
 	return out
 }
 
-func Run(d *dsn.MySQL, query string, setVars []string, binaryMode bool) error {
-	addr := fmt.Sprintf("%s:%d", d.Host(), d.Port())
-	conn, err := client.Connect(addr, d.User(), d.Password(), d.Db(), connOptions(d.Options())...)
+// resultStats accumulates row and column statistics for one result set.
+type resultStats struct {
+	cols         []colStats
+	rowCount     int64
+	totalSize    int64
+	minRowSize   int64
+	maxRowSize   int64
+	affectedRows uint64
+}
+
+func newResultStats() *resultStats {
+	return &resultStats{minRowSize: math.MaxInt64}
+}
+
+func (r *resultStats) addRow(fields []*mysql.Field, row []mysql.FieldValue, binaryMode bool) {
+	if r.cols == nil {
+		r.cols = initColStats(fields)
+	}
+	stats := r.cols
+	r.rowCount++
+	var rowSize int64
+	for i := range row {
+		v := row[i].Value()
+		if v == nil {
+			stats[i].nullCount++
+			continue
+		}
+		var l int
+		if binaryMode {
+			if fixed := typeFixedSize(stats[i].typeCode, stats[i].decimals); fixed > 0 {
+				l = fixed
+			} else {
+				l = len(valueBytes(v))
+			}
+		} else {
+			b := valueBytes(v)
+			l = len(b)
+			if l == 0 {
+				stats[i].emptyCount++
+			}
+		}
+		if l < stats[i].minLen {
+			stats[i].minLen = l
+		}
+		if l > stats[i].maxLen {
+			stats[i].maxLen = l
+		}
+		stats[i].sumLen += int64(l)
+		stats[i].count++
+		rowSize += int64(l)
+	}
+	r.totalSize += rowSize
+	if rowSize < r.minRowSize {
+		r.minRowSize = rowSize
+	}
+	if rowSize > r.maxRowSize {
+		r.maxRowSize = rowSize
+	}
+}
+
+// finish records the final result metadata once the result set is done.
+func (r *resultStats) finish(result *mysql.Result) {
+	// Empty result set: no rows were scanned, init stats from fields.
+	// An OK packet leaves Fields empty and cols nil, and a failed
+	// statement leaves no Resultset at all.
+	if r.cols == nil && result.Resultset != nil && len(result.Fields) > 0 {
+		r.cols = initColStats(result.Fields)
+	}
+	r.affectedRows = result.AffectedRows
+}
+
+// collector gathers the statistics of every result set a step returns.
+type collector struct {
+	binaryMode bool
+	progress   *progress // nil unless a progress line is shown
+	results    []*resultStats
+}
+
+// stream adds a result set read row by row through fn.
+func (c *collector) stream(fn func(result *mysql.Result, perRow client.SelectPerRowCallback) error) error {
+	rs := newResultStats()
+	c.results = append(c.results, rs)
+	result := &mysql.Result{}
+	err := fn(result, func(row []mysql.FieldValue) error {
+		rs.addRow(result.Fields, row, c.binaryMode)
+		if c.progress != nil {
+			c.progress.update(rs.rowCount, rs.totalSize)
+		}
+		return nil
+	})
+	rs.finish(result)
+	return err
+}
+
+// collect adds a result set that was read into memory.
+func (c *collector) collect(result *mysql.Result) {
+	rs := newResultStats()
+	if result.Resultset != nil {
+		for _, row := range result.Values {
+			rs.addRow(result.Fields, row, c.binaryMode)
+		}
+	}
+	rs.finish(result)
+	c.results = append(c.results, rs)
+}
+
+// step is one round trip to the server within a measurement.
+type step struct {
+	text string
+	exec func(c *collector) error
+}
+
+// stmtReport is the per-statement breakdown of a client-side split batch.
+type stmtReport struct {
+	text    string
+	elapsed time.Duration
+	before  map[string]int64
+	after   map[string]int64
+	results []*resultStats
+}
+
+// report holds everything printed after a run.
+type report struct {
+	text       string
+	showText   bool
+	conn       *connInfo
+	context    *serverContext
+	fp         *fingerprint
+	params     []any
+	elapsed    time.Duration
+	outcome    outcome
+	before     map[string]int64
+	after      map[string]int64
+	results    []*resultStats
+	statements []*stmtReport
+	trx        *trxStats
+}
+
+func checkStatement(query string, opts Options) error {
+	switch {
+	case opts.DMLRollback:
+		// Anything beyond plain DML may commit implicitly, so it is
+		// refused even with --allow-writes.
+		if err := statement.Check(query, statement.Read, statement.Write); err != nil {
+			return fmt.Errorf("dml-rollback: %w", err)
+		}
+	case !opts.AllowWrites:
+		err := statement.CheckReadOnly(query)
+		if errors.Is(err, statement.ErrUnverified) {
+			// The statement still runs in a read-only transaction, so
+			// text the parser does not know need not push users to
+			// --allow-writes, which drops that protection as well.
+			if fbErr := statement.CheckUnparsed(query); fbErr != nil {
+				return fmt.Errorf("safety check: %w, and %w (use --allow-writes to run it anyway)", err, fbErr)
+			}
+			fmt.Fprintf(os.Stderr, "warning: %v; running it in a read-only transaction\n", err)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("safety check: %w (use --allow-writes to run it anyway)", err)
+		}
+	}
+	return nil
+}
+
+// connect opens a connection for d. multi is passed to connOptions.
+func connect(d *dsn.MySQL, multi bool) (*client.Conn, error) {
+	options := connOptions(d.Options(), multi)
+	tlsConfig, err := d.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	t, err := getTimeouts(d)
 	if err != nil {
-		return fmt.Errorf("connect: %w", err)
+		return nil, err
+	}
+	conn, err := dialWithTimeout(d, t, tlsConfig, options...)
+	if err != nil {
+		return nil, err
 	}
-	defer conn.Close()
 
-	if err := setSessionVars(conn, setVars); err != nil {
-		return err
+	opts := d.Options()
+	if charset := opts.Get("charset"); charset != "" {
+		if err := conn.SetCharset(charset); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("charset: %w", err)
+		}
+	}
+	if cmd := opts.Get("initCommand"); cmd != "" {
+		if err := runInitCommand(conn, cmd); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("init command: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// connInfo describes the transport the measurement ran over.
+type connInfo struct {
+	address string
+	network string
+	sslMode string
+	tls     *tls.ConnectionState
+}
+
+func getConnInfo(conn *client.Conn, d *dsn.MySQL) *connInfo {
+	info := &connInfo{
+		address: d.Address(),
+		network: d.Network(),
+		sslMode: d.SSLMode(),
+	}
+	if tc, ok := conn.Conn.Conn.(*tls.Conn); ok {
+		cs := tc.ConnectionState()
+		info.tls = &cs
+	}
+	return info
+}
+
+func printConnInfo(info *connInfo) {
+	fmt.Println("=== Connection ===")
+	fmt.Printf("  Address:          %s (%s)\n", info.address, info.network)
+	if info.tls != nil {
+		fmt.Printf("  TLS:              %s, %s\n",
+			tls.VersionName(info.tls.Version), tls.CipherSuiteName(info.tls.CipherSuite))
+		fmt.Printf("  SSL mode:         %s\n", info.sslMode)
+	} else if info.sslMode == dsn.SSLModePreferred {
+		fmt.Println("  TLS:              not in use (ssl mode PREFERRED)")
+	} else {
+		fmt.Println("  TLS:              disabled")
 	}
+	fmt.Println()
+}
 
-	before, err := getSessionStatus(conn)
+// runInitCommand sends sql, which may hold several statements, and discards
+// the results. The server does the splitting, so no parsing is involved.
+// Multi-statement support is switched on for the command only, unless the
+// connection has it anyway.
+func runInitCommand(conn *client.Conn, sql string) error {
+	if !conn.HasCapability(mysql.CLIENT_MULTI_STATEMENTS) {
+		if err := setMultiStatements(conn, true); err != nil {
+			return err
+		}
+		defer setMultiStatements(conn, false)
+	}
+	var firstErr error
+	_, err := conn.ExecuteMultiple(sql, func(_ *mysql.Result, err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	})
 	if err != nil {
 		return err
 	}
+	return firstErr
+}
+
+// COM_SET_OPTION arguments.
+const (
+	optionMultiStatementsOn  = 0
+	optionMultiStatementsOff = 1
+)
+
+// setMultiStatements sends COM_SET_OPTION, which turns multi-statement
+// support on or off for an open connection. go-mysql has no call for it.
+func setMultiStatements(conn *client.Conn, on bool) error {
+	opt := byte(optionMultiStatementsOff)
+	if on {
+		opt = optionMultiStatementsOn
+	}
+	pc := conn.Conn
+	pc.ResetSequence()
+	// The first four bytes are room for the packet header.
+	if err := pc.WritePacket([]byte{0, 0, 0, 0, mysql.COM_SET_OPTION, opt, 0}); err != nil {
+		return fmt.Errorf("set option: %w", err)
+	}
+	data, err := pc.ReadPacket()
+	if err != nil {
+		return fmt.Errorf("set option: %w", err)
+	}
+	if len(data) > 0 && data[0] == mysql.ERR_HEADER {
+		return fmt.Errorf("set option: %w", parseErrPacket(data))
+	}
+	return nil
+}
+
+// parseErrPacket decodes an ERR packet sent in reply to a protocol
+// command: the header byte, the error code, an optional SQL state marker
+// and state, and the message.
+func parseErrPacket(data []byte) error {
+	if len(data) < 3 {
+		return errors.New("malformed error packet")
+	}
+	code := uint16(data[1]) | uint16(data[2])<<8
+	msg := data[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	return mysql.NewError(code, string(msg))
+}
+
+// setupSession prepares the session before any snapshot is taken, so none
+// of this shows up in the status deltas. Init commands run first, then
+// --set-var, then the execution time limit. It returns the effective values
+// of the --set-var variables.
+func setupSession(conn *client.Conn, opts Options) ([]varValue, error) {
+	for i, cmd := range opts.InitCommands {
+		if err := runInitCommand(conn, cmd); err != nil {
+			return nil, fmt.Errorf("init command %d: %w", i+1, err)
+		}
+	}
+	vars, err := setSessionVars(conn, opts.SetVars)
+	if err != nil {
+		return nil, err
+	}
+	return vars, setMaxExecutionTime(conn, opts.MaxExecutionTime)
+}
+
+// measure runs steps in order, each between two session status snapshots.
+// The batch delta is the sum of the step deltas, so the snapshots taken
+// in between do not count towards it.
+func measure(conn *client.Conn, opts Options, steps ...step) (*report, error) {
+	// In safety mode the query also runs inside a read-only transaction,
+	// so that stored functions cannot modify data behind the parser's back.
+	// With --dml-rollback the transaction is read-write and always rolled
+	// back.
+	if opts.DMLRollback {
+		for _, st := range steps {
+			if err := checkTransactional(conn, st.text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.DMLRollback || !opts.AllowWrites {
+		if err := conn.BeginTx(!opts.DMLRollback, ""); err != nil {
+			return nil, fmt.Errorf("start transaction: %w", err)
+		}
+		defer conn.Rollback()
+	}
 
 	var (
-		stats      []colStats
-		rowCount   int64
-		totalSize  int64
-		minRowSize int64 = math.MaxInt64
-		maxRowSize int64
+		trxBefore map[string]int64
+		err       error
 	)
+	if opts.DMLRollback {
+		if trxBefore, err = getLockStatus(conn); err != nil {
+			return nil, err
+		}
+	}
 
-	result := &mysql.Result{}
-	start := time.Now()
-	err = conn.ExecuteSelectStreaming(query, result,
-		func(row []mysql.FieldValue) error {
-			if stats == nil {
-				stats = initColStats(result.Fields)
+	rep := &report{
+		outcome: outcome{completed: true, limit: opts.MaxExecutionTime},
+	}
+	for _, st := range steps {
+		before, err := getSessionStatus(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &collector{binaryMode: opts.BinaryMode}
+		if opts.Progress {
+			c.progress = startProgress(os.Stderr)
+		}
+		resetWatch(conn)
+		start := time.Now()
+		err = st.exec(c)
+		elapsed := time.Since(start)
+		if c.progress != nil {
+			c.progress.stop()
+		}
+
+		if err != nil {
+			if !isTimeoutError(err) {
+				return nil, fmt.Errorf("query: %w", classifyError(err, conn))
 			}
-			rowCount++
-			var rowSize int64
-			for i := range row {
-				v := row[i].Value()
-				if v == nil {
-					stats[i].nullCount++
-					continue
-				}
-				var l int
-				if binaryMode {
-					if fixed := typeFixedSize(stats[i].typeCode, stats[i].decimals); fixed > 0 {
-						l = fixed
-					} else {
-						l = len(valueBytes(v))
-					}
-				} else {
-					b := valueBytes(v)
-					l = len(b)
-					if l == 0 {
-						stats[i].emptyCount++
+			rep.outcome.completed = false
+		}
+
+		after, err := getSessionStatus(conn)
+		if err != nil {
+			return nil, err
+		}
+
+		if rep.before == nil {
+			rep.before = before
+			rep.after = make(map[string]int64, len(before))
+			for name, v := range before {
+				rep.after[name] = v
+			}
+		}
+		for name, v := range after {
+			rep.after[name] += v - before[name]
+		}
+		rep.elapsed += elapsed
+		rep.results = append(rep.results, c.results...)
+		rep.statements = append(rep.statements, &stmtReport{
+			text:    st.text,
+			elapsed: elapsed,
+			before:  before,
+			after:   after,
+			results: c.results,
+		})
+
+		if !rep.outcome.completed {
+			break
+		}
+	}
+	if len(steps) < 2 {
+		rep.statements = nil
+	}
+
+	if opts.DMLRollback {
+		if rep.trx, err = captureTrxStats(conn, trxBefore); err != nil {
+			return nil, err
+		}
+		if err := rollback(conn); err != nil {
+			return nil, err
+		}
+		rep.trx.rolledBack = true
+	}
+	return rep, nil
+}
+
+// streamStep sends query with COM_QUERY and streams its single result set.
+func streamStep(conn *client.Conn, query string) step {
+	return step{
+		text: query,
+		exec: func(c *collector) error {
+			return c.stream(func(result *mysql.Result, perRow client.SelectPerRowCallback) error {
+				return conn.ExecuteSelectStreaming(query, result, perRow, nil)
+			})
+		},
+	}
+}
+
+// multiStep sends query with COM_QUERY and reads every result set it
+// returns. Each result set is buffered in memory before it is measured.
+func multiStep(conn *client.Conn, query string) step {
+	return step{
+		text: query,
+		exec: func(c *collector) error {
+			var firstErr error
+			_, err := conn.ExecuteMultiple(query, func(result *mysql.Result, err error) {
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
 					}
+					return
 				}
-				if l < stats[i].minLen {
-					stats[i].minLen = l
-				}
-				if l > stats[i].maxLen {
-					stats[i].maxLen = l
-				}
-				stats[i].sumLen += int64(l)
-				stats[i].count++
-				rowSize += int64(l)
-			}
-			totalSize += rowSize
-			if rowSize < minRowSize {
-				minRowSize = rowSize
+				c.collect(result)
+			})
+			if err != nil {
+				return err
 			}
-			if rowSize > maxRowSize {
-				maxRowSize = rowSize
-			}
-			return nil
+			return firstErr
 		},
-		nil,
-	)
-	elapsed := time.Since(start)
+	}
+}
 
+// needsMulti reports whether query is sent as a batch or holds a CALL,
+// the only cases where buildSteps needs a connection opened with multi
+// set.
+func needsMulti(query string, opts Options) bool {
+	nodes, err := statement.Parse(query)
 	if err != nil {
-		return fmt.Errorf("query: %w", err)
+		return false
+	}
+	for _, n := range nodes {
+		if statement.IsCall(n) {
+			return true
+		}
 	}
+	return len(nodes) > 1 && !opts.SplitStatements
+}
 
-	// Empty result set: no rows were scanned, init stats from fields.
-	if stats == nil {
-		stats = initColStats(result.Fields)
+// buildSteps decides how query is sent. A single statement is streamed.
+// Several statements, or a CALL that may return several result sets, are
+// sent as one batch, or one statement at a time with --split-statements.
+// On a connection opened without multi, several statements are always sent
+// one at a time and CALL is refused.
+func buildSteps(conn *client.Conn, query string, opts Options) ([]step, error) {
+	nodes, err := statement.Parse(query)
+	if err != nil || len(nodes) == 0 {
+		// Unparseable queries get here with --allow-writes, or as a
+		// single read-only looking statement.
+		return []step{streamStep(conn, query)}, nil
+	}
+	multi := conn.HasCapability(mysql.CLIENT_MULTI_STATEMENTS)
+	for _, n := range nodes {
+		if statement.IsCall(n) && !multi {
+			return nil, errors.New("CALL is only supported as the query of a single run")
+		}
+	}
+	if len(nodes) == 1 && !statement.IsCall(nodes[0]) {
+		return []step{streamStep(conn, query)}, nil
+	}
+	if multi && (!opts.SplitStatements || len(nodes) == 1) {
+		return []step{multiStep(conn, query)}, nil
+	}
+	steps := make([]step, len(nodes))
+	for i, n := range nodes {
+		text := strings.TrimSpace(n.Text())
+		if statement.IsCall(n) {
+			steps[i] = multiStep(conn, text)
+		} else {
+			steps[i] = streamStep(conn, text)
+		}
 	}
+	return steps, nil
+}
 
-	after, err := getSessionStatus(conn)
+func Run(d *dsn.MySQL, query string, opts Options) error {
+	if err := checkStatement(query, opts); err != nil {
+		return err
+	}
+
+	s, err := open(d, opts, needsMulti(query, opts))
 	if err != nil {
 		return err
 	}
+	defer s.Close()
 
-	printResults(elapsed, rowCount, totalSize, minRowSize, maxRowSize, before, after, stats)
-	return nil
+	if len(opts.Params) > 0 {
+		return runPrepared(s.conn, s.info, s.context, query, opts)
+	}
+	return s.Run(query)
+}
+
+// outcome describes how the measured statement finished.
+type outcome struct {
+	completed bool
+	limit     time.Duration
+}
+
+func (o outcome) String() string {
+	if o.completed {
+		return "completed"
+	}
+	return fmt.Sprintf("timed out (server limit %s exceeded)", formatDuration(o.limit))
 }
 
 func formatDuration(d time.Duration) string {
@@ -409,23 +899,97 @@ func formatInt(n int64) string {
 	return fmt.Sprintf("%d", n)
 }
 
-func printResults(elapsed time.Duration, rowCount, totalSize, minRowSize, maxRowSize int64, before, after map[string]int64, cols []colStats) {
+func printResults(rep *report) {
+	// Transport
+	if rep.conn != nil {
+		printConnInfo(rep.conn)
+	}
+
+	// Server and session context
+	if rep.context != nil {
+		printServerContext(rep.context)
+	}
+
+	// Query text
+	if rep.showText {
+		printQueryText(rep.text)
+	}
+
+	// Normalised form and digests
+	if rep.fp != nil {
+		printFingerprint(rep.fp)
+	}
+
 	// Execution time
 	fmt.Println("=== Query Execution ===")
-	fmt.Printf("  Execution time:   %s\n", formatDuration(elapsed))
+	fmt.Printf("  Execution time:   %s\n", formatDuration(rep.elapsed))
+	fmt.Printf("  Outcome:          %s\n", rep.outcome)
+	if len(rep.statements) > 1 {
+		fmt.Printf("  Statements:       %d (split client-side)\n", len(rep.statements))
+	}
+	if len(rep.results) > 1 {
+		fmt.Printf("  Result sets:      %d\n", len(rep.results))
+	}
 	fmt.Println()
 
+	// Bound parameters
+	if rep.params != nil {
+		printParams(rep.params)
+	}
+
 	// Session status
-	printSessionStatus(before, after)
-
-	// Result summary
-	fmt.Println("=== Result Summary ===")
-	fmt.Printf("  Rows returned:    %s\n", formatInt(rowCount))
-	if rowCount > 0 {
-		fmt.Printf("  Total data size:  %s\n\n", formatBytes(totalSize))
-		fmt.Printf("  Min row size:     %s\n", formatBytes(minRowSize))
-		fmt.Printf("  Avg row size:     %s\n", formatBytes(totalSize/rowCount))
-		fmt.Printf("  Max row size:     %s\n", formatBytes(maxRowSize))
+	printSessionStatus(rep.before, rep.after)
+
+	// Per-statement breakdown (--split-statements only)
+	for i, st := range rep.statements {
+		printStatement(i, len(rep.statements), st)
+	}
+
+	// Transaction (--dml-rollback only)
+	if rep.trx != nil {
+		printTrxStats(rep.trx)
+	}
+
+	for i, r := range rep.results {
+		label := ""
+		if len(rep.results) > 1 {
+			label = fmt.Sprintf(" (result set %d of %d)", i+1, len(rep.results))
+		}
+
+		// Result summary
+		printResultSummary(r, rep.outcome, label)
+
+		// Column statistics
+		printColumnStats(r.cols, label)
+	}
+}
+
+func printStatement(i, n int, st *stmtReport) {
+	fmt.Printf("=== Statement %d of %d ===\n", i+1, n)
+	fmt.Printf("  Query:            %s\n", oneLine(st.text, 60))
+	fmt.Printf("  Execution time:   %s\n", formatDuration(st.elapsed))
+	fmt.Printf("  Result sets:      %d\n", len(st.results))
+	printStatusGroups(st.before, st.after)
+	fmt.Println()
+}
+
+func printResultSummary(r *resultStats, o outcome, label string) {
+	fmt.Printf("=== Result Summary%s ===\n", label)
+	if !o.completed {
+		fmt.Println("  (partial result, received before the query was aborted)")
+	}
+	if r.cols == nil {
+		// OK packet: the statement returned no result set.
+		fmt.Printf("  Rows affected:    %d\n", r.affectedRows)
+		fmt.Println()
+		return
+	}
+	fmt.Printf("  Rows returned:    %s\n", formatInt(r.rowCount))
+	if r.rowCount > 0 {
+		fmt.Printf("  Total data size:  %s\n\n", formatBytes(r.totalSize))
+		fmt.Printf("  Min row size:     %s\n", formatBytes(r.minRowSize))
+		fmt.Printf("  Avg row size:     %s\n", formatBytes(r.totalSize/r.rowCount))
+		fmt.Printf("  Max row size:     %s\n", formatBytes(r.maxRowSize))
 	} else {
 		fmt.Printf("  Total data size:  0 B\n\n")
 		fmt.Printf("  Min row size:     0 B\n")
@@ -433,9 +997,14 @@ func printResults(elapsed time.Duration, rowCount, totalSize, minRowSize, maxRow
 		fmt.Printf("  Max row size:     0 B\n")
 	}
 	fmt.Println()
+}
 
-	// Column statistics
-	printColumnStats(cols)
+func printQueryText(text string) {
+	fmt.Println("=== Query ===")
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+	fmt.Println()
 }
 
 func printSessionStatus(before, after map[string]int64) {
@@ -453,6 +1022,11 @@ func printSessionStatus(before, after map[string]int64) {
 	}
 
 	fmt.Println("=== Session Status Changes ===")
+	printStatusGroups(before, after)
+	fmt.Println()
+}
+
+func printStatusGroups(before, after map[string]int64) {
 	for _, grp := range statusGroups {
 		// Collect nonzero diffs for this group
 		type entry struct {
@@ -482,10 +1056,9 @@ func printSessionStatus(before, after map[string]int64) {
 			fmt.Printf("    %-*s  %s\n", maxNameLen, e.name, formatInt(e.diff))
 		}
 	}
-	fmt.Println()
 }
 
-func printColumnStats(cols []colStats) {
+func printColumnStats(cols []colStats, label string) {
 	if len(cols) == 0 {
 		return
 	}
@@ -558,7 +1131,7 @@ func printColumnStats(cols []colStats) {
 		fmt.Println("  " + strings.Join(parts, "  "))
 	}
 
-	fmt.Println("=== Column Statistics ===")
+	fmt.Printf("=== Column Statistics%s ===\n", label)
 	printRow(headers, nil)
 	fmt.Println(sep())
 	rightAlign := []bool{false, false, true, true, true, true, true, true}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+
+	"github.com/dbnski/query-stats/statement"
+)
+
+func TestCollectorStreamFailedStatement(t *testing.T) {
+	// go-mysql leaves Resultset nil when the server answers with an ERR
+	// packet, as it does for an unknown table or a syntax error.
+	serverErr := mysql.NewError(1146, "Table 'test.nosuch' doesn't exist")
+	c := &collector{}
+	err := c.stream(func(result *mysql.Result, perRow client.SelectPerRowCallback) error {
+		return serverErr
+	})
+	if !errors.Is(err, serverErr) {
+		t.Fatalf("stream returned %v, want %v", err, serverErr)
+	}
+	if len(c.results) != 1 {
+		t.Fatalf("got %d result sets, want 1", len(c.results))
+	}
+	if r := c.results[0]; r.cols != nil || r.rowCount != 0 {
+		t.Errorf("failed statement left cols=%v rowCount=%d", r.cols, r.rowCount)
+	}
+}
+
+func TestCollectorStreamRows(t *testing.T) {
+	c := &collector{}
+	err := c.stream(func(result *mysql.Result, perRow client.SelectPerRowCallback) error {
+		result.Resultset = &mysql.Resultset{
+			Fields: []*mysql.Field{{Name: []byte("name"), Type: mysql.MYSQL_TYPE_VAR_STRING}},
+		}
+		for _, v := range []string{"alice", ""} {
+			row := []mysql.FieldValue{mysql.NewFieldValue(mysql.FieldValueTypeString, 0, []byte(v))}
+			if err := perRow(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := c.results[0]
+	if r.rowCount != 2 || r.totalSize != 5 {
+		t.Errorf("rowCount=%d totalSize=%d, want 2 and 5", r.rowCount, r.totalSize)
+	}
+	if len(r.cols) != 1 || r.cols[0].emptyCount != 1 || r.cols[0].maxLen != 5 {
+		t.Errorf("unexpected column stats %+v", r.cols)
+	}
+}
+
+func TestCheckStatementUnparsed(t *testing.T) {
+	// The parser does not know JSON_TABLE; the query is let through to run
+	// in the read-only transaction, but not as --dml-rollback.
+	query := "SELECT * FROM JSON_TABLE('[1]', '$[*]' COLUMNS (a INT PATH '$')) AS j"
+	if err := checkStatement(query, Options{}); err != nil {
+		t.Errorf("read-only: %v", err)
+	}
+	if err := checkStatement(query, Options{DMLRollback: true}); err == nil {
+		t.Error("dml-rollback accepted an unverified statement")
+	}
+	if err := checkStatement(query+" INTO OUTFILE '/tmp/j'", Options{}); !errors.Is(err, statement.ErrNotAllowed) {
+		t.Errorf("INTO OUTFILE: got %v, want ErrNotAllowed", err)
+	}
+}
+
+func TestOneLine(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"SELECT 1", 60, "SELECT 1"},
+		{"SELECT *\n  FROM t\n WHERE a = 1", 60, "SELECT * FROM t WHERE a = 1"},
+		{"SELECT 'abcdefgh'", 10, "SELECT ..."},
+		// Multi-byte text is cut between characters, not inside one.
+		{"SELECT 'zażółć gęślą'", 16, "SELECT 'zażół..."},
+	}
+	for _, tt := range tests {
+		if got := oneLine(tt.s, tt.n); got != tt.want {
+			t.Errorf("oneLine(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/client"
+
+	"github.com/dbnski/query-stats/dsn"
+	"github.com/dbnski/query-stats/statement"
+)
+
+// ErrNoQuery is returned by session commands that act on the previous
+// query before one has been run.
+var ErrNoQuery = errors.New("no query has been run yet")
+
+// Session is a connection that stays open across queries, set up once with
+// the init commands and --set-var assignments.
+type Session struct {
+	conn    *client.Conn
+	info    *connInfo
+	context *serverContext
+	vars    []varValue
+	opts    Options
+	db      string // current default database
+
+	query       string       // last query run
+	fp          *fingerprint // fingerprint of query
+	last, prev  *report      // reports for the last two queries
+	showContext bool         // print Context with the next report
+}
+
+// Open connects and prepares the session. The connection cannot send
+// batches of statements or CALL; several statements in one query are sent
+// one at a time.
+func Open(d *dsn.MySQL, opts Options) (*Session, error) {
+	return open(d, opts, false)
+}
+
+func open(d *dsn.MySQL, opts Options, multi bool) (*Session, error) {
+	conn, err := connect(d, multi)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := setupSession(conn, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ctx, err := getServerContext(conn, vars)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Session{
+		conn:        conn,
+		info:        getConnInfo(conn, d),
+		context:     ctx,
+		vars:        vars,
+		opts:        opts,
+		db:          d.Db(),
+		showContext: true,
+	}, nil
+}
+
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// Run checks, runs and reports query. Connection and Context are only
+// printed with the first report, and again after the context changes.
+func (s *Session) Run(query string) error {
+	rep, err := s.measure(query)
+	if err != nil {
+		return err
+	}
+	printResults(rep)
+	if !rep.outcome.completed {
+		return ErrQueryTimeout
+	}
+	return nil
+}
+
+// measure checks and runs query and returns its report without printing
+// it.
+func (s *Session) measure(query string) (*report, error) {
+	if err := checkStatement(query, s.opts); err != nil {
+		return nil, err
+	}
+	steps, err := buildSteps(s.conn, query, s.opts)
+	if err != nil {
+		return nil, err
+	}
+	rep, err := measure(s.conn, s.opts, steps...)
+	if err != nil {
+		return nil, err
+	}
+	if s.last == nil && s.prev == nil {
+		rep.conn = s.info
+	}
+	if s.showContext {
+		rep.context = s.context
+		s.showContext = false
+	}
+	if s.fp == nil || query != s.query {
+		s.fp = getFingerprint(s.conn, s.context, query)
+	}
+	rep.fp = s.fp
+	rep.text = query
+	rep.showText = s.opts.EchoQuery
+	s.query, s.prev, s.last = query, s.last, rep
+	return rep, nil
+}
+
+// Repeat runs the last query n times and prints one line per run followed
+// by an aggregate.
+func (s *Session) Repeat(n int) error {
+	if s.query == "" {
+		return ErrNoQuery
+	}
+	reports := make([]*report, 0, n)
+	for i := 0; i < n; i++ {
+		steps, err := buildSteps(s.conn, s.query, s.opts)
+		if err != nil {
+			return err
+		}
+		rep, err := measure(s.conn, s.opts, steps...)
+		if err != nil {
+			return fmt.Errorf("run %d: %w", i+1, err)
+		}
+		rep.text = s.query
+		rep.fp = s.fp
+		fmt.Printf("  Run %-4d %10s  %s, %s rows\n", i+1, formatDuration(rep.elapsed),
+			rep.outcome, formatInt(rep.rowsReturned()))
+		reports = append(reports, rep)
+	}
+	fmt.Println()
+	printAggregate(reports, "runs")
+	s.prev, s.last = s.last, reports[len(reports)-1]
+	return nil
+}
+
+// SetVar applies one --set-var style assignment and prints the effective
+// value. The Context section is printed again with the next report.
+func (s *Session) SetVar(arg string) error {
+	vars, err := setSessionVars(s.conn, []string{arg})
+	if err != nil {
+		return err
+	}
+	for _, v := range vars {
+		fmt.Printf("  %s = %s\n", v.name, v.value)
+		s.vars = mergeVarValues(s.vars, v)
+	}
+	ctx, err := getServerContext(s.conn, s.vars)
+	if err != nil {
+		return err
+	}
+	s.context, s.showContext = ctx, true
+	return nil
+}
+
+func mergeVarValues(vars []varValue, v varValue) []varValue {
+	for i := range vars {
+		if vars[i].name == v.name {
+			vars[i] = v
+			return vars
+		}
+	}
+	return append(vars, v)
+}
+
+// useDB changes the default database if it differs from the current one.
+func (s *Session) useDB(db string) error {
+	if db == "" || db == s.db {
+		return nil
+	}
+	if err := s.conn.UseDB(db); err != nil {
+		return fmt.Errorf("use %s: %w", db, err)
+	}
+	s.db = db
+	return nil
+}
+
+// profile runs a sample query taken from a log or from the server. A
+// sample that the safety check refuses, or that fails, gets a note and a
+// nil report; only network errors and incomplete rollbacks are returned.
+func (s *Session) profile(db, query string) (*report, error) {
+	err := s.useDB(db)
+	var rep *report
+	if err == nil {
+		rep, err = s.measure(query)
+	}
+	switch {
+	case err == nil:
+		return rep, nil
+	case IsNetworkError(err), errors.Is(err, ErrRollbackIncomplete):
+		return nil, err
+	case errors.Is(err, statement.ErrNotAllowed):
+		fmt.Printf("  Skipped: %v\n\n", err)
+	default:
+		fmt.Printf("  Failed: %v\n\n", err)
+	}
+	return nil, nil
+}
+
+// SetBinaryMode switches between --mode text and --mode binary.
+func (s *Session) SetBinaryMode(binary bool) {
+	s.opts.BinaryMode = binary
+}
+
+// BinaryMode reports the current size measurement mode.
+func (s *Session) BinaryMode() bool {
+	return s.opts.BinaryMode
+}
+
+// PrintContext prints the current Context section.
+func (s *Session) PrintContext() {
+	printServerContext(s.context)
+}
+
+// Explain prints the plan of query, or of the last query when query is
+// empty. The plan is printed one row at a time, as the mysql client does
+// with \G, because EXPLAIN output is too wide for a table.
+func (s *Session) Explain(query string) error {
+	if query == "" {
+		query = s.query
+	}
+	if query == "" {
+		return ErrNoQuery
+	}
+	if err := checkStatement(query, s.opts); err != nil {
+		return err
+	}
+	nodes, err := statement.Parse(query)
+	if err == nil && len(nodes) > 1 {
+		return errors.New("explain: only a single statement can be explained")
+	}
+	result, err := s.conn.Execute("EXPLAIN " + query)
+	if err != nil {
+		return fmt.Errorf("explain: %w", err)
+	}
+	defer result.Close()
+
+	fmt.Println("=== Explain ===")
+	width := 0
+	for _, f := range result.Fields {
+		width = max(width, len(f.Name))
+	}
+	for i := range result.Values {
+		fmt.Printf("  *************************** %d. row ***************************\n", i+1)
+		for j, f := range result.Fields {
+			value := "NULL"
+			if null, _ := result.IsNull(i, j); !null {
+				value, _ = result.GetString(i, j)
+			}
+			fmt.Printf("  %*s: %s\n", width, f.Name, value)
+		}
+	}
+	fmt.Println()
+	return nil
+}
+
+// Compare prints the last two reports side by side.
+func (s *Session) Compare() error {
+	if s.prev == nil {
+		return errors.New("compare: need two queries run in this session")
+	}
+	printComparison(s.prev, s.last)
+	return nil
+}
+
+func printComparison(a, b *report) {
+	fmt.Println("=== Compare ===")
+	fmt.Printf("  Previous:  %s\n", oneLine(a.text, 70))
+	fmt.Printf("  Last:      %s\n", oneLine(b.text, 70))
+	fmt.Println()
+
+	type line struct {
+		name, a, b, change string
+	}
+	lines := []line{
+		{"Execution time", formatDuration(a.elapsed), formatDuration(b.elapsed), percentChange(
+			float64(a.elapsed), float64(b.elapsed))},
+		{"Rows returned", formatInt(a.rowsReturned()), formatInt(b.rowsReturned()),
+			countChange(a.rowsReturned(), b.rowsReturned())},
+		{"Total data size", formatBytes(a.totalSize()), formatBytes(b.totalSize()),
+			countChange(a.totalSize(), b.totalSize())},
+	}
+	for _, grp := range statusGroups {
+		for _, v := range grp.vars {
+			da, db := a.after[v]-a.before[v], b.after[v]-b.before[v]
+			if da != 0 || db != 0 {
+				lines = append(lines, line{v, formatInt(da), formatInt(db), countChange(da, db)})
+			}
+		}
+	}
+
+	nameWidth, aWidth, bWidth := 0, len("Previous"), len("Last")
+	for _, l := range lines {
+		nameWidth = max(nameWidth, len(l.name))
+		aWidth = max(aWidth, len(l.a))
+		bWidth = max(bWidth, len(l.b))
+	}
+	fmt.Printf("  %-*s  %*s  %*s  %s\n", nameWidth, "", aWidth, "Previous", bWidth, "Last", "Change")
+	for _, l := range lines {
+		fmt.Printf("  %-*s  %*s  %*s  %s\n", nameWidth, l.name, aWidth, l.a, bWidth, l.b, l.change)
+	}
+	fmt.Println()
+}
+
+func percentChange(a, b float64) string {
+	if a == b {
+		return "-"
+	}
+	if a == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (b-a)/a*100)
+}
+
+func countChange(a, b int64) string {
+	if a == b {
+		return "-"
+	}
+	return fmt.Sprintf("%+d", b-a)
+}
+
+// oneLine collapses whitespace in a query and shortens it to n characters.
+func oneLine(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-3]) + "..."
+	}
+	return s
+}
+
+// rowsReturned sums the rows of every result set.
+func (r *report) rowsReturned() int64 {
+	var n int64
+	for _, rs := range r.results {
+		n += rs.rowCount
+	}
+	return n
+}
+
+// rowsExamined sums the Handler_read_* deltas.
+func (r *report) rowsExamined() int64 {
+	var n int64
+	for _, grp := range statusGroups {
+		if grp.title != "Rows Examined" {
+			continue
+		}
+		for _, v := range grp.vars {
+			n += r.after[v] - r.before[v]
+		}
+	}
+	return n
+}
+
+// totalSize sums the data size of every result set.
+func (r *report) totalSize() int64 {
+	var n int64
+	for _, rs := range r.results {
+		n += rs.totalSize
+	}
+	return n
+}
@@ -0,0 +1,151 @@
+package runner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/client"
+)
+
+// varNameRe matches system variable names, including component variables
+// such as validate_password.length.
+var varNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// setVar is one --set-var assignment. The value is bound as a parameter
+// unless expr is set, in which case expr is sent as SQL text.
+type setVar struct {
+	name  string
+	value any
+	expr  string
+}
+
+// parseSetVar parses one --set-var argument:
+//
+//	name=value     value is bound as by ParseParam
+//	name=@default  resets the variable to its global value
+//	name:=expr     expr is sent verbatim as an SQL expression
+func parseSetVar(s string) (setVar, error) {
+	idx := strings.IndexByte(s, '=')
+	if idx < 1 || idx == len(s)-1 {
+		return setVar{}, fmt.Errorf("--set-var: expected name=value or name:=expr, got %q", s)
+	}
+	name, value := s[:idx], s[idx+1:]
+	v := setVar{name: strings.ToLower(name)}
+	switch {
+	case strings.HasSuffix(name, ":"):
+		v.name = strings.ToLower(strings.TrimSuffix(name, ":"))
+		v.expr = value
+	case strings.EqualFold(value, "@default"):
+		v.expr = "DEFAULT"
+	default:
+		v.value = ParseParam(value)
+	}
+	if !varNameRe.MatchString(v.name) {
+		return setVar{}, fmt.Errorf("--set-var: invalid variable name %q", v.name)
+	}
+	return v, nil
+}
+
+func (v setVar) statement() (string, []any) {
+	if v.expr != "" {
+		return fmt.Sprintf("SET SESSION %s = %s", v.name, v.expr), nil
+	}
+	return fmt.Sprintf("SET SESSION %s = ?", v.name), []any{v.value}
+}
+
+// varValue is the value a session variable has after --set-var ran.
+type varValue struct {
+	name  string
+	value string
+}
+
+// setSessionVars applies --set-var assignments in order and returns the
+// effective value of each variable, as the server reports it afterwards.
+func setSessionVars(conn *client.Conn, args []string) ([]varValue, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	vars := make([]setVar, len(args))
+	for i, a := range args {
+		v, err := parseSetVar(a)
+		if err != nil {
+			return nil, err
+		}
+		vars[i] = v
+	}
+	if err := checkVarNames(conn, vars); err != nil {
+		return nil, err
+	}
+	for _, v := range vars {
+		stmt, args := v.statement()
+		if _, err := conn.Execute(stmt, args...); err != nil {
+			return nil, fmt.Errorf("set-var %s: %w", v.name, err)
+		}
+	}
+	return effectiveValues(conn, vars)
+}
+
+// checkVarNames refuses names that are not session variables on the
+// server. performance_schema.session_variables only lists variables with
+// session scope, so global-only variables are refused as well. When the
+// table cannot be read, the check is skipped and SET reports any error.
+func checkVarNames(conn *client.Conn, vars []setVar) error {
+	placeholders := make([]string, len(vars))
+	args := make([]any, len(vars))
+	for i, v := range vars {
+		placeholders[i] = "?"
+		args[i] = v.name
+	}
+	result, err := conn.Execute(
+		"SELECT LOWER(VARIABLE_NAME) FROM performance_schema.session_variables WHERE VARIABLE_NAME IN ("+
+			strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		return nil
+	}
+	defer result.Close()
+
+	known := make(map[string]bool)
+	for _, row := range result.Values {
+		known[string(row[0].AsString())] = true
+	}
+	for _, v := range vars {
+		if !known[v.name] {
+			return fmt.Errorf("set-var %s: unknown session variable", v.name)
+		}
+	}
+	return nil
+}
+
+// effectiveValues reads back each variable once, in the order it was first
+// set.
+func effectiveValues(conn *client.Conn, vars []setVar) ([]varValue, error) {
+	var (
+		names []string
+		exprs []string
+		seen  = make(map[string]bool)
+	)
+	for _, v := range vars {
+		if !seen[v.name] {
+			seen[v.name] = true
+			names = append(names, v.name)
+			exprs = append(exprs, "@@SESSION."+v.name)
+		}
+	}
+	result, err := conn.Execute("SELECT " + strings.Join(exprs, ", "))
+	if err != nil {
+		return nil, fmt.Errorf("set-var: reading back values: %w", err)
+	}
+	defer result.Close()
+
+	values := make([]varValue, len(names))
+	for i, name := range names {
+		values[i].name = name
+		if null, _ := result.IsNull(0, i); null {
+			values[i].value = "NULL"
+		} else {
+			values[i].value = string(result.Values[0][i].AsString())
+		}
+	}
+	return values, nil
+}
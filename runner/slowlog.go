@@ -0,0 +1,207 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dbnski/query-stats/dsn"
+	"github.com/dbnski/query-stats/slowlog"
+	"github.com/dbnski/query-stats/statement"
+)
+
+// slowGroup is every logged query that shares one fingerprint.
+type slowGroup struct {
+	fingerprint  string
+	digest       string
+	entries      []slowlog.Entry
+	totalTime    time.Duration
+	lockTime     time.Duration
+	rowsSent     int64
+	rowsExamined int64
+}
+
+// sample returns the entry with the median query time, as a run that is
+// neither the lucky nor the unlucky one.
+func (g *slowGroup) sample() slowlog.Entry {
+	sorted := make([]slowlog.Entry, len(g.entries))
+	copy(sorted, g.entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].QueryTime < sorted[j].QueryTime
+	})
+	return sorted[len(sorted)/2]
+}
+
+func (g *slowGroup) count() int64 {
+	return int64(len(g.entries))
+}
+
+// groupSlowLog groups entries by fingerprint, largest total time first.
+func groupSlowLog(entries []slowlog.Entry) []*slowGroup {
+	byDigest := make(map[string]*slowGroup)
+	var groups []*slowGroup
+	for _, e := range entries {
+		fp, digest := statement.Fingerprint(e.Query)
+		g, ok := byDigest[digest]
+		if !ok {
+			g = &slowGroup{fingerprint: fp, digest: digest}
+			byDigest[digest] = g
+			groups = append(groups, g)
+		}
+		g.entries = append(g.entries, e)
+		g.totalTime += e.QueryTime
+		g.lockTime += e.LockTime
+		g.rowsSent += e.RowsSent
+		g.rowsExamined += e.RowsExamined
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].totalTime > groups[j].totalTime
+	})
+	return groups
+}
+
+// RunSlowLog reads a slow query log, picks the top fingerprints by total
+// query time and profiles the median sample of each on one connection.
+// Fingerprints whose sample the safety check refuses are passed over
+// without counting towards top. Samples that fail are reported and
+// skipped; a network error stops the run.
+func RunSlowLog(d *dsn.MySQL, path string, top int, opts Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("slow log: %w", err)
+	}
+	entries, err := slowlog.Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("slow log: %w", err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("slow log: no queries in %s", path)
+	}
+
+	groups := groupSlowLog(entries)
+	var logged time.Duration
+	for _, g := range groups {
+		logged += g.totalTime
+	}
+
+	s, err := Open(d, opts)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Fingerprints whose sample the safety check refuses are passed over
+	// before top is applied, so they do not take the place of ones that
+	// can run.
+	var (
+		candidates []*slowGroup
+		refused    int
+	)
+	for _, g := range groups {
+		if top > 0 && len(candidates) == top {
+			break
+		}
+		if checkStatement(g.sample().Query, s.opts) != nil {
+			refused++
+			continue
+		}
+		candidates = append(candidates, g)
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("slow log: no fingerprint with a runnable sample (%d passed over)", refused)
+	}
+	groups = candidates
+	printSlowLogSummary(path, len(entries), logged, groups)
+	if refused > 0 {
+		fmt.Printf("Passed over %d fingerprints whose samples the safety check refuses.\n\n", refused)
+	}
+
+	timedOut := false
+	for i, g := range groups {
+		fmt.Printf("##### Fingerprint %d of %d #####\n\n", i+1, len(groups))
+		sample := g.sample()
+		printSlowLogGroup(g, sample, logged)
+
+		// Samples without a logged database run in the DSN's database.
+		db := sample.DB
+		if db == "" {
+			db = d.Db()
+		}
+		rep, err := s.profile(db, sample.Query)
+		if err != nil {
+			return err
+		}
+		if rep == nil {
+			continue
+		}
+		printSlowLogComparison(g, sample, rep)
+		printResults(rep)
+		timedOut = timedOut || !rep.outcome.completed
+	}
+	if timedOut {
+		return ErrQueryTimeout
+	}
+	return nil
+}
+
+func printSlowLogSummary(path string, n int, logged time.Duration, groups []*slowGroup) {
+	fmt.Println("=== Slow Log ===")
+	fmt.Printf("  File:             %s\n", path)
+	fmt.Printf("  Queries logged:   %d\n", n)
+	fmt.Printf("  Total time:       %s\n", formatDuration(logged))
+	fmt.Println()
+	fmt.Printf("  %4s  %8s  %12s  %12s  %6s  %s\n", "Rank", "Count", "Total", "Avg", "Share", "Fingerprint")
+	for i, g := range groups {
+		fmt.Printf("  %4d  %8d  %12s  %12s  %5.1f%%  %s\n", i+1, g.count(),
+			formatDuration(g.totalTime), formatDuration(g.totalTime/time.Duration(g.count())),
+			share(g.totalTime, logged), oneLine(g.fingerprint, 60))
+	}
+	fmt.Println()
+}
+
+func share(part, whole time.Duration) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
+
+func printSlowLogGroup(g *slowGroup, sample slowlog.Entry, logged time.Duration) {
+	fmt.Println("=== Slow Log Group ===")
+	fmt.Printf("  Digest:           %s\n", g.digest)
+	fmt.Printf("  Normalized:       %s\n", oneLine(g.fingerprint, 200))
+	fmt.Printf("  Queries logged:   %d\n", g.count())
+	fmt.Printf("  Total time:       %s (%.1f%% of logged time)\n", formatDuration(g.totalTime), share(g.totalTime, logged))
+	fmt.Printf("  Sample:           line %d", sample.Line)
+	if !sample.Time.IsZero() {
+		fmt.Printf(", %s", sample.Time.Format(time.RFC3339))
+	}
+	if sample.DB != "" {
+		fmt.Printf(", database %s", sample.DB)
+	}
+	fmt.Println(" (median query time)")
+	fmt.Println()
+}
+
+// printSlowLogComparison shows the logged figures for the sample and the
+// fingerprint average next to the fresh measurement. Rows examined is
+// measured as the sum of the Handler_read_* deltas, which is close to but
+// not the same counter as the slow log's.
+func printSlowLogComparison(g *slowGroup, sample slowlog.Entry, rep *report) {
+	n := g.count()
+	examined := rep.rowsExamined()
+
+	fmt.Println("=== Logged vs Measured ===")
+	fmt.Printf("  %-15s  %14s  %14s  %14s\n", "", "Logged sample", "Logged avg", "Measured")
+	fmt.Printf("  %-15s  %14s  %14s  %14s\n", "Query time",
+		formatDuration(sample.QueryTime), formatDuration(g.totalTime/time.Duration(n)), formatDuration(rep.elapsed))
+	fmt.Printf("  %-15s  %14s  %14s  %14s\n", "Lock time",
+		formatDuration(sample.LockTime), formatDuration(g.lockTime/time.Duration(n)), "-")
+	fmt.Printf("  %-15s  %14d  %14d  %14d\n", "Rows sent",
+		sample.RowsSent, g.rowsSent/n, rep.rowsReturned())
+	fmt.Printf("  %-15s  %14d  %14d  %14d\n", "Rows examined",
+		sample.RowsExamined, g.rowsExamined/n, examined)
+	fmt.Println()
+}
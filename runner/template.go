@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are available in query templates in addition to the
+// text/template builtins.
+var templateFuncs = template.FuncMap{
+	"quote": quoteString,
+	"ident": quoteIdent,
+}
+
+// quoteString returns v as a single-quoted SQL string literal.
+func quoteString(v any) string {
+	s := fmt.Sprint(v)
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// quoteIdent returns v as a backtick-quoted identifier.
+func quoteIdent(v any) string {
+	return "`" + strings.ReplaceAll(fmt.Sprint(v), "`", "``") + "`"
+}
+
+// RenderQuery expands query as a text/template with vars as its data. A
+// reference to a variable that is not defined is an error rather than an
+// empty string. Errors already carry a "template:" prefix.
+func RenderQuery(query string, vars map[string]any) (string, error) {
+	t, err := template.New("query").Funcs(templateFuncs).Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// ParseDefine splits a --define argument into its key and value.
+func ParseDefine(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("--define: expected key=value, got %q", s)
+	}
+	return key, value, nil
+}
+
+// LoadVars reads template variables from a file. A .json file holds one
+// object whose values are used as they are, so numbers and lists keep
+// their type. Any other file holds key=value lines, with blank lines and
+// lines starting with # ignored.
+func LoadVars(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("vars file: %w", err)
+	}
+	vars := make(map[string]any)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, &vars); err != nil {
+			return nil, fmt.Errorf("vars file: %w", err)
+		}
+		return vars, nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := ParseDefine(line)
+		if err != nil {
+			return nil, fmt.Errorf("vars file: line %d: expected key=value", n)
+		}
+		vars[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("vars file: %w", err)
+	}
+	return vars, nil
+}
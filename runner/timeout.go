@@ -0,0 +1,263 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+
+	"github.com/dbnski/query-stats/dsn"
+)
+
+// defaultConnectTimeout matches client.Connect.
+const defaultConnectTimeout = 10 * time.Second
+
+// Network failures are reported wrapping one of these, so that scripts can
+// tell them apart from query errors.
+var (
+	ErrConnectTimeout = errors.New("connect timeout")
+	ErrConnectFailed  = errors.New("connection failed")
+	ErrReadTimeout    = errors.New("read timeout")
+	ErrWriteTimeout   = errors.New("write timeout")
+	ErrConnectionLost = errors.New("connection lost")
+)
+
+// IsNetworkError reports whether err is one of the categorised network
+// errors above, or an uncategorised error that means the connection is
+// gone.
+func IsNetworkError(err error) bool {
+	return errors.Is(err, ErrConnectTimeout) ||
+		errors.Is(err, ErrConnectFailed) ||
+		errors.Is(err, ErrReadTimeout) ||
+		errors.Is(err, ErrWriteTimeout) ||
+		errors.Is(err, ErrConnectionLost) ||
+		isConnLost(err)
+}
+
+// isConnLost reports whether err comes from the transport rather than the
+// server: the server closing the connection, a reset, or any other
+// net.Error. go-mysql wraps those it sees in mysql.ErrBadConn.
+func isConnLost(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, mysql.ErrBadConn) ||
+		errors.As(err, &netErr)
+}
+
+type timeouts struct {
+	connect time.Duration
+	read    time.Duration
+	write   time.Duration
+}
+
+func getTimeouts(d *dsn.MySQL) (timeouts, error) {
+	var (
+		t   timeouts
+		err error
+	)
+	if t.connect, err = d.ConnectTimeout(defaultConnectTimeout); err != nil {
+		return t, err
+	}
+	if t.read, err = d.ReadTimeout(); err != nil {
+		return t, err
+	}
+	if t.write, err = d.WriteTimeout(); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+func (t timeouts) option() client.Option {
+	return func(c *client.Conn) error {
+		c.ReadTimeout = t.read
+		c.WriteTimeout = t.write
+		return nil
+	}
+}
+
+// watchedConn remembers which direction last timed out, and the last
+// other read or write error. go-mysql flattens network errors into
+// strings, so the error chain alone cannot tell.
+type watchedConn struct {
+	net.Conn
+	timedOut string // "read" or "write"
+	failed   error
+	greeting []byte // read ahead by readGreeting, returned by Read first
+}
+
+func (c *watchedConn) Read(b []byte) (int, error) {
+	if len(c.greeting) > 0 {
+		n := copy(b, c.greeting)
+		c.greeting = c.greeting[n:]
+		return n, nil
+	}
+	n, err := c.Conn.Read(b)
+	c.record(err, "read")
+	return n, err
+}
+
+// readGreeting reads the server's initial handshake packet ahead of
+// go-mysql, which reads it again from the buffer, and returns the lower
+// capability flags it announces. go-mysql only decides to use TLS after
+// reading them, and does not expose them, so this is how PREFERRED finds
+// out whether the server offers TLS. A greeting that is not a protocol 10
+// handshake, such as an error packet, announces nothing.
+func (c *watchedConn) readGreeting() (uint16, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return 0, err
+	}
+	payload := make([]byte, int(header[0])|int(header[1])<<8|int(header[2])<<16)
+	if _, err := io.ReadFull(c, payload); err != nil {
+		return 0, err
+	}
+	c.greeting = append(header, payload...)
+
+	// protocol version, server version, connection id, auth data, filler
+	if len(payload) == 0 || payload[0] != 10 {
+		return 0, nil
+	}
+	end := bytes.IndexByte(payload[1:], 0)
+	if end < 0 {
+		return 0, nil
+	}
+	pos := 1 + end + 1 + 4 + 8 + 1
+	if len(payload) < pos+2 {
+		return 0, nil
+	}
+	return binary.LittleEndian.Uint16(payload[pos:]), nil
+}
+
+func (c *watchedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.record(err, "write")
+	return n, err
+}
+
+func (c *watchedConn) record(err error, dir string) {
+	switch {
+	case err == nil:
+	case isNetTimeout(err):
+		c.timedOut = dir
+	default:
+		c.failed = err
+	}
+}
+
+// watched returns the watchedConn under conn, looking through TLS.
+func watched(conn *client.Conn) *watchedConn {
+	nc := conn.Conn.Conn
+	if tc, ok := nc.(*tls.Conn); ok {
+		nc = tc.NetConn()
+	}
+	w, _ := nc.(*watchedConn)
+	return w
+}
+
+// resetWatch forgets what happened on conn so far, so that classifyError
+// only sees the failures of the command that follows. Otherwise an earlier
+// timeout would be blamed for any later error.
+func resetWatch(conn *client.Conn) {
+	if w := watched(conn); w != nil {
+		w.timedOut, w.failed = "", nil
+	}
+}
+
+// dialWithTimeout connects with client.ConnectWithDialer, bounding both the
+// TCP connect and the MySQL handshake by the connect timeout. Dialing alone
+// would leave the handshake to wait on a server that accepts but never
+// answers. With tlsConfig set the connection is encrypted; under PREFERRED
+// only if the server's greeting offers TLS.
+func dialWithTimeout(d *dsn.MySQL, t timeouts, tlsConfig *tls.Config, options ...client.Option) (*client.Conn, error) {
+	deadline := time.Now().Add(t.connect)
+	dialer := &net.Dialer{Timeout: t.connect}
+	var (
+		raw        *watchedConn
+		serverCaps uint16
+	)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.SetDeadline(deadline); err != nil {
+			c.Close()
+			return nil, err
+		}
+		raw = &watchedConn{Conn: c}
+		if tlsConfig != nil {
+			if serverCaps, err = raw.readGreeting(); err != nil {
+				c.Close()
+				return nil, err
+			}
+		}
+		return raw, nil
+	}
+	if tlsConfig != nil {
+		// Options are applied after dialing, once the greeting is read.
+		options = append(slices.Clip(options), func(c *client.Conn) error {
+			if uint32(serverCaps)&mysql.CLIENT_SSL != 0 || d.SSLMode() != dsn.SSLModePreferred {
+				c.SetTLSConfig(tlsConfig)
+			}
+			return nil
+		})
+	}
+
+	conn, err := client.ConnectWithDialer(context.Background(), "",
+		d.Address(), d.User(), d.Password(), d.Db(), dial, append(options, t.option())...)
+	if err != nil {
+		if isNetTimeout(err) || (raw != nil && raw.timedOut != "") {
+			return nil, fmt.Errorf("%w: %s did not respond within %s", ErrConnectTimeout, d.Address(), t.connect)
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) {
+			return nil, fmt.Errorf("%w: %w", ErrConnectFailed, err)
+		}
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	// from here on the read and write timeouts apply
+	if err := raw.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
+	return conn, nil
+}
+
+func isNetTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// classifyError turns network timeouts on an established connection into
+// ErrReadTimeout or ErrWriteTimeout, and other transport failures into
+// ErrConnectionLost. Other errors are left alone.
+func classifyError(err error, conn *client.Conn) error {
+	if w := watched(conn); w != nil {
+		switch w.timedOut {
+		case "read":
+			return fmt.Errorf("%w: no data from server for %s", ErrReadTimeout, conn.ReadTimeout)
+		case "write":
+			return fmt.Errorf("%w: could not send to server for %s", ErrWriteTimeout, conn.WriteTimeout)
+		}
+		if w.failed != nil {
+			return fmt.Errorf("%w: %w", ErrConnectionLost, w.failed)
+		}
+	}
+	if isConnLost(err) {
+		return fmt.Errorf("%w: %w", ErrConnectionLost, err)
+	}
+	return err
+}
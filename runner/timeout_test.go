@@ -0,0 +1,127 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/client"
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/packet"
+)
+
+func TestIsNetworkError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"eof", io.EOF, true},
+		{"unexpected eof", fmt.Errorf("read packet: %w", io.ErrUnexpectedEOF), true},
+		{"reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"broken pipe", &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{"bad conn", fmt.Errorf("io.ReadFull(header) failed. err EOF: %w", mysql.ErrBadConn), true},
+		{"read timeout", fmt.Errorf("query: %w", ErrReadTimeout), true},
+		{"connection lost", ErrConnectionLost, true},
+		{"server error", mysql.NewError(1146, "Table 'test.nosuch' doesn't exist"), false},
+		{"query timeout", ErrQueryTimeout, false},
+		{"other", errors.New("prepare: wrong number of placeholders"), false},
+	}
+	for _, tt := range tests {
+		if got := IsNetworkError(tt.err); got != tt.want {
+			t.Errorf("%s: IsNetworkError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyErrorClosedConnection(t *testing.T) {
+	local, remote := net.Pipe()
+	w := &watchedConn{Conn: local}
+	conn := &client.Conn{Conn: packet.NewConn(w)}
+	remote.Close()
+	if _, err := w.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read from a closed pipe succeeded")
+	}
+
+	// go-mysql flattens the cause into its message, so only the
+	// watchedConn knows the connection is gone.
+	err := classifyError(errors.New("io.ReadFull(header) failed. err EOF"), conn)
+	if !errors.Is(err, ErrConnectionLost) || !errors.Is(err, io.EOF) {
+		t.Errorf("classifyError = %v, want ErrConnectionLost wrapping io.EOF", err)
+	}
+	if !IsNetworkError(err) {
+		t.Errorf("IsNetworkError(%v) = false", err)
+	}
+}
+
+func TestResetWatch(t *testing.T) {
+	w := &watchedConn{timedOut: "read"}
+	conn := &client.Conn{Conn: packet.NewConn(w)}
+	serverErr := mysql.NewError(1146, "Table 'test.nosuch' doesn't exist")
+	if err := classifyError(serverErr, conn); !errors.Is(err, ErrReadTimeout) {
+		t.Fatalf("classifyError before reset = %v, want ErrReadTimeout", err)
+	}
+	resetWatch(conn)
+	if err := classifyError(serverErr, conn); err != serverErr {
+		t.Errorf("classifyError after reset = %v, want %v", err, serverErr)
+	}
+}
+
+// greetingPacket builds a protocol 10 handshake packet announcing caps.
+func greetingPacket(caps uint32) []byte {
+	payload := []byte{10}
+	payload = append(payload, "8.0.36\x00"...)
+	payload = append(payload, 1, 0, 0, 0)                // connection id
+	payload = append(payload, "abcdefgh"...)             // auth data, part 1
+	payload = append(payload, 0)                         // filler
+	payload = append(payload, byte(caps), byte(caps>>8)) // lower capability flags
+	payload = append(payload, 255, 2, 0, byte(caps>>16), byte(caps>>24), 21)
+	payload = append(payload, make([]byte, 10)...)
+	payload = append(payload, "ijklmnopqrst\x00mysql_native_password\x00"...)
+	n := len(payload)
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), 0}, payload...)
+}
+
+func TestReadGreeting(t *testing.T) {
+	errPacket := []byte{9, 0, 0, 0, 0xff, 0x10, 0x04, 'T', 'o', 'o', ' ', 'm', 'a'}
+	tests := []struct {
+		name   string
+		packet []byte
+		ssl    bool
+	}{
+		{"tls offered", greetingPacket(mysql.CLIENT_PROTOCOL_41 | mysql.CLIENT_SSL), true},
+		{"no tls", greetingPacket(mysql.CLIENT_PROTOCOL_41), false},
+		{"error packet", errPacket, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+			go func() {
+				remote.Write(append(tt.packet, "next"...))
+				remote.Close()
+			}()
+
+			c := &watchedConn{Conn: local}
+			caps, err := c.readGreeting()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := uint32(caps)&mysql.CLIENT_SSL != 0; got != tt.ssl {
+				t.Errorf("CLIENT_SSL = %v, want %v (caps %#x)", got, tt.ssl, caps)
+			}
+			// The greeting is read again, followed by what came after it.
+			replay, err := io.ReadAll(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := string(tt.packet) + "next"; string(replay) != want {
+				t.Errorf("read %q after the greeting, want %q", replay, want)
+			}
+		})
+	}
+}
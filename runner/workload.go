@@ -0,0 +1,313 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strings"
+
+	"github.com/dbnski/query-stats/dsn"
+)
+
+// paramGen produces the value bound to one placeholder on each execution.
+type paramGen struct {
+	desc string
+	next func() any
+}
+
+// randomChars is the alphabet of the "string" generator.
+const randomChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// parseParamGen reads one entry of a workload query's params. A scalar is
+// bound as is; an object with a single key picks a generator:
+//
+//	{"int": [min, max]}      uniform integer, both ends included
+//	{"float": [min, max]}    uniform float
+//	{"choice": [v1, v2 ...]} one of the values
+//	{"string": n}            n random lowercase letters and digits
+func parseParamGen(v any) (paramGen, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		c, err := jsonParam(v)
+		if err != nil {
+			return paramGen{}, err
+		}
+		return paramGen{desc: formatParam(c), next: func() any { return c }}, nil
+	}
+	if len(obj) != 1 {
+		return paramGen{}, errors.New("a generator is an object with a single key")
+	}
+	var (
+		kind string
+		arg  any
+	)
+	for kind, arg = range obj {
+	}
+	switch kind {
+	case "int":
+		lo, hi, err := genIntRange(arg)
+		if err != nil {
+			return paramGen{}, fmt.Errorf("int: %w", err)
+		}
+		// The span is computed in uint64, where hi-lo cannot overflow;
+		// only the full int64 range has no room for the +1.
+		span := uint64(hi) - uint64(lo)
+		if span == math.MaxUint64 {
+			return paramGen{}, errors.New("int: range is too wide")
+		}
+		return paramGen{
+			desc: fmt.Sprintf("int %d..%d", lo, hi),
+			next: func() any { return lo + int64(rand.Uint64N(span+1)) },
+		}, nil
+	case "float":
+		lo, hi, err := genRange(arg)
+		if err != nil {
+			return paramGen{}, fmt.Errorf("float: %w", err)
+		}
+		return paramGen{
+			desc: fmt.Sprintf("float %g..%g", lo, hi),
+			next: func() any { return lo + rand.Float64()*(hi-lo) },
+		}, nil
+	case "choice":
+		list, ok := arg.([]any)
+		if !ok || len(list) == 0 {
+			return paramGen{}, errors.New("choice: expected a non-empty array of values")
+		}
+		values := make([]any, len(list))
+		descs := make([]string, len(list))
+		for i, item := range list {
+			c, err := jsonParam(item)
+			if err != nil {
+				return paramGen{}, fmt.Errorf("choice: %w", err)
+			}
+			values[i], descs[i] = c, formatParam(c)
+		}
+		return paramGen{
+			desc: "choice " + strings.Join(descs, "|"),
+			next: func() any { return values[rand.IntN(len(values))] },
+		}, nil
+	case "string":
+		num, ok := arg.(json.Number)
+		n, err := num.Int64()
+		if !ok || err != nil || n < 1 {
+			return paramGen{}, errors.New("string: expected a positive length")
+		}
+		return paramGen{
+			desc: fmt.Sprintf("string of %d", n),
+			next: func() any {
+				b := make([]byte, n)
+				for i := range b {
+					b[i] = randomChars[rand.IntN(len(randomChars))]
+				}
+				return string(b)
+			},
+		}, nil
+	default:
+		return paramGen{}, fmt.Errorf("unknown generator %q (use int, float, choice or string)", kind)
+	}
+}
+
+// genRange reads a [min, max] pair.
+func genRange(arg any) (lo, hi float64, err error) {
+	pair, ok := arg.([]any)
+	if !ok || len(pair) != 2 {
+		return 0, 0, errors.New("expected [min, max]")
+	}
+	a, okA := pair[0].(json.Number)
+	b, okB := pair[1].(json.Number)
+	if !okA || !okB {
+		return 0, 0, errors.New("expected [min, max]")
+	}
+	if lo, err = a.Float64(); err != nil {
+		return 0, 0, err
+	}
+	if hi, err = b.Float64(); err != nil {
+		return 0, 0, err
+	}
+	if lo > hi {
+		return 0, 0, errors.New("min is greater than max")
+	}
+	return lo, hi, nil
+}
+
+// genIntRange reads a [min, max] pair of integers. The bounds are parsed
+// as integers rather than floats, so that large values are neither rounded
+// nor converted out of range.
+func genIntRange(arg any) (lo, hi int64, err error) {
+	pair, ok := arg.([]any)
+	if !ok || len(pair) != 2 {
+		return 0, 0, errors.New("expected [min, max]")
+	}
+	a, okA := pair[0].(json.Number)
+	b, okB := pair[1].(json.Number)
+	if !okA || !okB {
+		return 0, 0, errors.New("expected [min, max]")
+	}
+	if lo, err = a.Int64(); err != nil {
+		return 0, 0, fmt.Errorf("min %s is not an integer in the int64 range", a)
+	}
+	if hi, err = b.Int64(); err != nil {
+		return 0, 0, fmt.Errorf("max %s is not an integer in the int64 range", b)
+	}
+	if lo > hi {
+		return 0, 0, errors.New("min is greater than max")
+	}
+	return lo, hi, nil
+}
+
+// workloadEntry is one query of a workload file.
+type workloadEntry struct {
+	Name   string   `json:"name"`
+	Query  string   `json:"query"`
+	Weight *float64 `json:"weight"`
+	Params []any    `json:"params"`
+}
+
+// loadWorkload reads a workload file: a JSON array of queries, each with
+// an optional name, a weight (1 if left out) and optional params, one
+// value or generator per ? placeholder. Queries with params run as
+// prepared statements.
+func loadWorkload(path string) ([]*loadQuery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("workload file: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	var entries []workloadEntry
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("workload file: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("workload file: no queries in %s", path)
+	}
+
+	queries := make([]*loadQuery, len(entries))
+	for i, e := range entries {
+		q := &loadQuery{
+			name:   e.Name,
+			text:   strings.TrimSpace(e.Query),
+			weight: 1,
+		}
+		if q.name == "" {
+			q.name = fmt.Sprintf("q%d", i+1)
+		}
+		if q.text == "" {
+			return nil, fmt.Errorf("workload file: %s: empty query", q.name)
+		}
+		if e.Weight != nil {
+			q.weight = *e.Weight
+		}
+		if q.weight <= 0 {
+			return nil, fmt.Errorf("workload file: %s: weight must be positive", q.name)
+		}
+		if e.Params != nil {
+			q.params = make([]paramGen, len(e.Params))
+			for j, p := range e.Params {
+				if q.params[j], err = parseParamGen(p); err != nil {
+					return nil, fmt.Errorf("workload file: %s, param %d: %w", q.name, j+1, err)
+				}
+			}
+		}
+		queries[i] = q
+	}
+	return queries, nil
+}
+
+// RunWorkload runs the weighted mix of queries in a workload file from
+// several connections, back to back or at lo.QPS, and reports latency and
+// payload for each query and for the whole mix.
+func RunWorkload(d *dsn.MySQL, path string, lo LoadOptions, opts Options) error {
+	queries, err := loadWorkload(path)
+	if err != nil {
+		return err
+	}
+	for _, q := range queries {
+		if err := checkStatement(q.text, opts); err != nil {
+			return fmt.Errorf("%s: %w", q.name, err)
+		}
+	}
+	r, err := runLoad(d, queries, lo, opts)
+	if err != nil {
+		return err
+	}
+
+	printConnInfo(r.info)
+	printServerContext(r.context)
+	printWorkload(queries)
+	printLoad(r, lo, queries)
+	return r.status()
+}
+
+func printWorkload(queries []*loadQuery) {
+	total := 0.0
+	for _, q := range queries {
+		total += q.weight
+	}
+	fmt.Println("=== Workload ===")
+	for i, q := range queries {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("  %s (weight %g, %.1f%%)\n", q.name, q.weight, q.weight/total*100)
+		fmt.Printf("    Query:          %s\n", oneLine(q.text, 200))
+		if q.params != nil {
+			descs := make([]string, len(q.params))
+			for j, p := range q.params {
+				descs[j] = p.desc
+			}
+			fmt.Printf("    Parameters:     %s\n", strings.Join(descs, ", "))
+		}
+		fmt.Printf("    Digest:         %s\n", q.fp.digest)
+		if q.fp.serverDigest != "" {
+			fmt.Printf("    Server digest:  %s\n", q.fp.serverDigest)
+		}
+	}
+	fmt.Println()
+}
+
+// printQueryBreakdown prints latency and payload for each query of a
+// workload and for all of them together.
+func printQueryBreakdown(r *loadRun, queries []*loadQuery, total *execStats) {
+	width := len("Query")
+	stats := make([]*execStats, len(queries))
+	for i, q := range queries {
+		width = max(width, len(q.name))
+		stats[i] = newExecStats()
+		for _, w := range r.workers {
+			stats[i].merge(w.stats[i])
+		}
+	}
+
+	fmt.Println("=== Latency ===")
+	printLatencyHeader("Query", width)
+	for i, q := range queries {
+		printLatencyRow(q.name, width, stats[i])
+	}
+	printLatencyRow("All", width, total)
+	fmt.Println()
+
+	fmt.Println("=== Payload ===")
+	fmt.Printf("  %-*s  %8s  %12s  %10s  %10s  %10s\n",
+		width, "Query", "Queries", "Rows", "Avg rows", "Data", "Avg size")
+	row := func(label string, s *execStats) {
+		n := int64(len(s.latencies))
+		avgRows, avgSize := "-", "-"
+		if n > 0 {
+			avgRows = fmt.Sprintf("%.1f", float64(s.rows)/float64(n))
+			avgSize = formatBytes(s.bytes / n)
+		}
+		fmt.Printf("  %-*s  %8d  %12d  %10s  %10s  %10s\n",
+			width, label, n, s.rows, avgRows, formatBytes(s.bytes), avgSize)
+	}
+	for i, q := range queries {
+		row(q.name, stats[i])
+	}
+	row("All", total)
+	fmt.Println()
+}
@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// decodeParam decodes a params entry the way loadWorkload does.
+func decodeParam(t *testing.T, s string) any {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return v
+}
+
+func TestParseParamGenInt(t *testing.T) {
+	tests := []struct {
+		param  string
+		lo, hi int64
+	}{
+		{`{"int": [1, 10]}`, 1, 10},
+		{`{"int": [-5, -5]}`, -5, -5},
+		{`{"int": [-9000000000000000000, 9000000000000000000]}`, -9e18, 9e18},
+		{`{"int": [0, 9223372036854775807]}`, 0, math.MaxInt64},
+		{`{"int": [9223372036854775806, 9223372036854775807]}`, math.MaxInt64 - 1, math.MaxInt64},
+		{`{"int": [-9223372036854775808, -1]}`, math.MinInt64, -1},
+	}
+	for _, tt := range tests {
+		g, err := parseParamGen(decodeParam(t, tt.param))
+		if err != nil {
+			t.Errorf("%s: %v", tt.param, err)
+			continue
+		}
+		for i := 0; i < 1000; i++ {
+			v := g.next().(int64)
+			if v < tt.lo || v > tt.hi {
+				t.Errorf("%s: generated %d", tt.param, v)
+				break
+			}
+		}
+	}
+}
+
+func TestParseParamGenErrors(t *testing.T) {
+	for _, param := range []string{
+		`{"int": [1.5, 10]}`,
+		`{"int": [0, 9223372036854775808]}`,
+		`{"int": [-1e19, 0]}`,
+		`{"int": [-9223372036854775808, 9223372036854775807]}`,
+		`{"int": [10, 1]}`,
+		`{"int": [1]}`,
+		`{"int": ["1", "2"]}`,
+		`{"float": [2, 1]}`,
+		`{"choice": []}`,
+		`{"string": 0}`,
+		`{"string": 2.5}`,
+		`{"uuid": true}`,
+		`{"int": [1, 2], "float": [1, 2]}`,
+	} {
+		if _, err := parseParamGen(decodeParam(t, param)); err == nil {
+			t.Errorf("%s: accepted", param)
+		}
+	}
+}
+
+func TestParseParamGenOthers(t *testing.T) {
+	g, err := parseParamGen(decodeParam(t, `{"choice": ["a", 2]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if v := g.next(); v != "a" && v != int64(2) {
+			t.Fatalf("choice generated %#v", v)
+		}
+	}
+
+	g, err = parseParamGen(decodeParam(t, `{"string": 8}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := g.next().(string); len(s) != 8 || strings.Trim(s, randomChars) != "" {
+		t.Errorf("string generated %q", s)
+	}
+
+	g, err = parseParamGen(decodeParam(t, `{"float": [0.5, 1.5]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := g.next().(float64); v < 0.5 || v > 1.5 {
+		t.Errorf("float generated %g", v)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+
+    "github.com/dbnski/query-stats/dsn"
+    "github.com/dbnski/query-stats/editor"
+    "github.com/dbnski/query-stats/runner"
+    "github.com/dbnski/query-stats/statement"
+)
+
+const shellHelp = `Queries end with ; (or \g, as in the mysql client). Commands:
+  \set name=value    Set a session variable (also name=@default, name:=expr)
+  \set               Show the current context
+  \mode text|binary  Switch the column size measurement mode
+  \repeat N          Run the last query N more times and aggregate
+  \explain [query]   Show the plan of the last query, or of query
+  \compare last      Compare the last two reports
+  \help              Show this help
+  \quit              Exit (also Ctrl+D)
+`
+
+// errQuit ends the shell.
+var errQuit = errors.New("quit")
+
+// queryComplete tells the editor when Enter should run the input: after a
+// terminator outside quotes and comments, or at once for a command.
+func queryComplete(text string) bool {
+    text = strings.TrimSpace(text)
+    switch {
+    case text == "":
+        return false
+    case strings.HasPrefix(text, `\`), isQuitWord(text):
+        return true
+    }
+    return statement.Terminated(text)
+}
+
+func isQuitWord(text string) bool {
+    text = strings.ToLower(strings.TrimSuffix(text, ";"))
+    return text == "exit" || text == "quit"
+}
+
+// trimTerminator removes the trailing \g, \G or ; from a query.
+func trimTerminator(q string) string {
+    q = strings.TrimSpace(q)
+    for _, t := range []string{`\G`, `\g`} {
+        q = strings.TrimSuffix(q, t)
+    }
+    return strings.TrimSpace(strings.TrimRight(q, "; \t\n"))
+}
+
+// runShell reads queries and commands until \quit or Ctrl+D. Query errors
+// are printed and the shell carries on; a network error ends it, because
+// the connection is gone.
+func runShell(d *dsn.MySQL, opts runner.Options) error {
+    s, err := runner.Open(d, opts)
+    if err != nil {
+        return err
+    }
+    defer s.Close()
+
+    history, err := editor.LoadHistory(editor.DefaultHistoryPath())
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "warning: history:", err)
+        history, _ = editor.LoadHistory("")
+    }
+    ed := editor.New(os.Stdin, os.Stderr)
+    ed.Prompt = "query-stats> "
+    ed.ContinuationPrompt = "          -> "
+    ed.History = history
+    ed.Complete = queryComplete
+
+    fmt.Fprintln(os.Stderr, `Type \help for commands, \quit or Ctrl+D to exit.`)
+    for {
+        input, err := ed.ReadQuery()
+        if errors.Is(err, editor.ErrInterrupted) {
+            continue
+        }
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+
+        input = strings.TrimSpace(input)
+        switch {
+        case input == "":
+            continue
+        case isQuitWord(input):
+            return nil
+        case strings.HasPrefix(input, `\`):
+            err = runCommand(s, input)
+        default:
+            query := trimTerminator(input)
+            if query == "" {
+                continue
+            }
+            err = s.Run(query)
+        }
+
+        switch {
+        case err == nil, errors.Is(err, runner.ErrQueryTimeout):
+            // a timed-out query has already been reported
+        case errors.Is(err, errQuit):
+            return nil
+        case runner.IsNetworkError(err):
+            return err
+        default:
+            fmt.Fprintln(os.Stderr, "error:", err)
+        }
+    }
+}
+
+func runCommand(s *runner.Session, input string) error {
+    cmd, arg, _ := strings.Cut(input, " ")
+    arg = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(arg), ";"))
+
+    switch strings.TrimSuffix(cmd, ";") {
+    case `\q`, `\quit`:
+        return errQuit
+    case `\h`, `\help`, `\?`:
+        fmt.Print(shellHelp)
+    case `\set`:
+        if arg == "" {
+            s.PrintContext()
+            return nil
+        }
+        return s.SetVar(arg)
+    case `\mode`:
+        switch arg {
+        case "":
+        case "text":
+            s.SetBinaryMode(false)
+        case "binary":
+            s.SetBinaryMode(true)
+        default:
+            return fmt.Errorf(`\mode: expected text or binary, got %q`, arg)
+        }
+        mode := "text"
+        if s.BinaryMode() {
+            mode = "binary"
+        }
+        fmt.Printf("  Mode: %s\n", mode)
+    case `\repeat`:
+        n, err := strconv.Atoi(arg)
+        if err != nil || n < 1 {
+            return fmt.Errorf(`\repeat: expected a positive count, got %q`, arg)
+        }
+        return s.Repeat(n)
+    case `\explain`:
+        return s.Explain(trimTerminator(arg))
+    case `\compare`:
+        if arg != "" && arg != "last" {
+            return fmt.Errorf(`\compare: only "last" is supported, got %q`, arg)
+        }
+        return s.Compare()
+    default:
+        return fmt.Errorf("unknown command %s (try \\help)", cmd)
+    }
+    return nil
+}
@@ -0,0 +1,204 @@
+// Package slowlog parses MySQL slow query log files, including the extra
+// header fields written by Percona Server and MariaDB.
+package slowlog
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is one logged query.
+type Entry struct {
+	Time         time.Time // from # Time, or SET timestamp when that is missing
+	User         string
+	Host         string
+	ThreadID     int64
+	DB           string // from use db; or # Schema, else the thread's last one
+	QueryTime    time.Duration
+	LockTime     time.Duration
+	RowsSent     int64
+	RowsExamined int64
+	Query        string // without the trailing ;
+	Line         int    // line number of the first header line
+}
+
+var (
+	// fieldRe matches the Name: value pairs of a # header line. The value
+	// may be empty, as Percona's Schema is for a thread without one.
+	fieldRe    = regexp.MustCompile(`([A-Za-z_]+): +([^\s:]*)(?:\s|$)`)
+	userHostRe = regexp.MustCompile(`^# User@Host: (\S*?)\[[^\]]*\] @ (\S*) ?\[([^\]]*)\]`)
+	threadIDRe = regexp.MustCompile(`\bId: +(\d+)`)
+	useRe      = regexp.MustCompile("(?i)^use +`?([^`;]+)`?;$")
+	setTimeRe  = regexp.MustCompile(`(?i)^SET timestamp=(\d+);$`)
+)
+
+// Parse reads every entry from a slow query log. The server's start-up
+// banner lines and administrator commands are skipped.
+//
+// The server only logs use db; when a connection's database changes, so an
+// entry without one inherits the database last logged for its thread.
+//
+// Every entry's header starts with a # Time or # User@Host line. Other
+// lines starting with # only belong to the header when they follow one of
+// those; after the query text has started they are part of the query.
+func Parse(r io.Reader) ([]Entry, error) {
+	var (
+		entries  []Entry
+		cur      *Entry
+		query    []string
+		inHeader bool
+		admin    bool
+		lineNo   int
+		threadDB = make(map[int64]string)
+	)
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		if cur.DB == "" {
+			cur.DB = threadDB[cur.ThreadID]
+		} else {
+			threadDB[cur.ThreadID] = cur.DB
+		}
+		text := strings.TrimSpace(strings.Join(query, "\n"))
+		text = strings.TrimSpace(strings.TrimSuffix(text, ";"))
+		if text != "" && !admin {
+			cur.Query = text
+			entries = append(entries, *cur)
+		}
+		cur, query, admin = nil, nil, false
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		switch {
+		case isEntryStart(line):
+			// A # Time line, or a second # User@Host line, opens a new
+			// header even when no query text followed the last one.
+			if !inHeader || strings.HasPrefix(line, "# Time: ") || cur.User != "" {
+				flush()
+				cur = &Entry{Line: lineNo}
+				inHeader = true
+			}
+			parseHeader(cur, line)
+			continue
+		case strings.HasPrefix(line, "# administrator command:"):
+			// Written in place of the query, after SET timestamp.
+			if cur != nil {
+				admin = true
+				inHeader = false
+			}
+			continue
+		case inHeader && strings.HasPrefix(line, "# "):
+			parseHeader(cur, line)
+			continue
+		case isBanner(line):
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		inHeader = false
+		trimmed := strings.TrimSpace(line)
+		if len(query) == 0 {
+			if m := useRe.FindStringSubmatch(trimmed); m != nil {
+				cur.DB = m[1]
+				continue
+			}
+			if m := setTimeRe.FindStringSubmatch(trimmed); m != nil {
+				if cur.Time.IsZero() {
+					ts, _ := strconv.ParseInt(m[1], 10, 64)
+					cur.Time = time.Unix(ts, 0).UTC()
+				}
+				continue
+			}
+			if trimmed == "" {
+				continue
+			}
+		}
+		query = append(query, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return entries, nil
+}
+
+// isEntryStart reports whether line is one that opens an entry's header.
+func isEntryStart(line string) bool {
+	return strings.HasPrefix(line, "# Time: ") || strings.HasPrefix(line, "# User@Host: ")
+}
+
+func parseHeader(e *Entry, line string) {
+	switch {
+	case strings.HasPrefix(line, "# Time: "):
+		e.Time = parseTime(strings.TrimSpace(line[len("# Time: "):]))
+		return
+	case strings.HasPrefix(line, "# User@Host: "):
+		if m := userHostRe.FindStringSubmatch(line); m != nil {
+			e.User = m[1]
+			e.Host = m[2]
+			if e.Host == "" {
+				e.Host = m[3]
+			}
+		}
+		if m := threadIDRe.FindStringSubmatch(line); m != nil {
+			e.ThreadID, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		return
+	}
+	for _, m := range fieldRe.FindAllStringSubmatch(line, -1) {
+		switch m[1] {
+		case "Query_time":
+			e.QueryTime = parseSeconds(m[2])
+		case "Lock_time":
+			e.LockTime = parseSeconds(m[2])
+		case "Rows_sent":
+			e.RowsSent, _ = strconv.ParseInt(m[2], 10, 64)
+		case "Rows_examined":
+			e.RowsExamined, _ = strconv.ParseInt(m[2], 10, 64)
+		case "Thread_id":
+			e.ThreadID, _ = strconv.ParseInt(m[2], 10, 64)
+		case "Schema":
+			if e.DB == "" {
+				e.DB = m[2]
+			}
+		}
+	}
+}
+
+// isBanner reports whether line is part of the banner the server writes
+// when it opens the log.
+func isBanner(line string) bool {
+	return strings.Contains(line, ", Version: ") && strings.Contains(line, "started with:") ||
+		strings.HasPrefix(line, "Tcp port: ") ||
+		strings.HasPrefix(line, "Time ") && strings.Contains(line, "Id Command")
+}
+
+func parseSeconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+// parseTime understands the MySQL 5.7+ ISO format and the older
+// YYMMDD HH:MM:SS format.
+func parseTime(s string) time.Time {
+	s = strings.Join(strings.Fields(s), " ")
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "060102 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
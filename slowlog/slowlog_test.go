@@ -0,0 +1,206 @@
+package slowlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func checkEntries(t *testing.T, log string, want []Entry) {
+	t.Helper()
+	got, err := Parse(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Time.Equal(w.Time) {
+			t.Errorf("entry %d: Time = %v, want %v", i, g.Time, w.Time)
+		}
+		g.Time, w.Time = time.Time{}, time.Time{}
+		if g != w {
+			t.Errorf("entry %d:\n got %+v\nwant %+v", i, g, w)
+		}
+	}
+}
+
+func TestParseMySQL80(t *testing.T) {
+	const log = `/usr/sbin/mysqld, Version: 8.0.36 (MySQL Community Server - GPL). started with:
+Tcp port: 3306  Unix socket: /var/run/mysqld/mysqld.sock
+Time                 Id Command    Argument
+# Time: 2024-03-05T10:15:32.123456Z
+# User@Host: app[app] @ web1 [10.0.0.5]  Id:    42
+# Query_time: 2.500000  Lock_time: 0.000100 Rows_sent: 10  Rows_examined: 50000
+use shop;
+SET timestamp=1709633732;
+SELECT id, total
+  FROM orders
+# only open orders
+ WHERE status = 'open';
+# Time: 2024-03-05T10:15:33.000000Z
+# User@Host: app[app] @ web1 [10.0.0.5]  Id:    42
+# Query_time: 0.000020  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 0
+SET timestamp=1709633733;
+# administrator command: Quit;
+# Time: 2024-03-05T10:15:34.500000Z
+# User@Host: report[report] @ localhost []  Id:    43
+# Query_time: 1.000000  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 100
+use hr;
+SET timestamp=1709633734;
+SELECT COUNT(*) FROM staff;
+# Time: 2024-03-05T10:15:35.000000Z
+# User@Host: app[app] @ web1 [10.0.0.5]  Id:    42
+# Query_time: 0.500000  Lock_time: 0.000050 Rows_sent: 1  Rows_examined: 1
+SET timestamp=1709633735;
+SELECT * FROM orders WHERE id = 7;
+`
+	checkEntries(t, log, []Entry{
+		{
+			Time: date("2024-03-05T10:15:32.123456Z"), User: "app", Host: "web1", ThreadID: 42, DB: "shop",
+			QueryTime: 2500 * time.Millisecond, LockTime: 100 * time.Microsecond, RowsSent: 10, RowsExamined: 50000,
+			Query: "SELECT id, total\n  FROM orders\n# only open orders\n WHERE status = 'open'",
+			Line:  4,
+		},
+		{
+			Time: date("2024-03-05T10:15:34.5Z"), User: "report", Host: "localhost", ThreadID: 43, DB: "hr",
+			QueryTime: time.Second, RowsSent: 1, RowsExamined: 100,
+			Query: "SELECT COUNT(*) FROM staff",
+			Line:  18,
+		},
+		{
+			// No use db; since the thread's last entry: still shop.
+			Time: date("2024-03-05T10:15:35Z"), User: "app", Host: "web1", ThreadID: 42, DB: "shop",
+			QueryTime: 500 * time.Millisecond, LockTime: 50 * time.Microsecond, RowsSent: 1, RowsExamined: 1,
+			Query: "SELECT * FROM orders WHERE id = 7",
+			Line:  24,
+		},
+	})
+}
+
+func TestParseMySQL57(t *testing.T) {
+	// A restart in the middle of the log writes the banner again.
+	const log = `# Time: 2024-03-05T10:15:32.123456Z
+# User@Host: app[app] @  [10.0.0.5]  Id:     7
+# Query_time: 3.000000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: 0
+use shop;
+SET timestamp=1709633732;
+SELECT SLEEP(3);
+/usr/sbin/mysqld, Version: 5.7.44-log (MySQL Community Server (GPL)). started with:
+Tcp port: 3306  Unix socket: /var/run/mysqld/mysqld.sock
+Time                 Id Command    Argument
+# Time: 2024-03-05T11:00:00.000000Z
+# User@Host: app[app] @  [10.0.0.5]  Id:     2
+# Query_time: 1.000000  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 1
+SET timestamp=1709636400;
+SELECT 1;
+`
+	checkEntries(t, log, []Entry{
+		{
+			Time: date("2024-03-05T10:15:32.123456Z"), User: "app", Host: "10.0.0.5", ThreadID: 7, DB: "shop",
+			QueryTime: 3 * time.Second, Query: "SELECT SLEEP(3)", Line: 1,
+		},
+		{
+			Time: date("2024-03-05T11:00:00Z"), User: "app", Host: "10.0.0.5", ThreadID: 2,
+			QueryTime: time.Second, RowsSent: 1, RowsExamined: 1, Query: "SELECT 1", Line: 10,
+		},
+	})
+}
+
+func TestParseOldTimeFormat(t *testing.T) {
+	// MySQL 5.6 and earlier write YYMMDD with a space-padded hour, and
+	// leave # Time out for queries logged in the same second.
+	const log = `# Time: 140101  9:05:03
+# User@Host: root[root] @ localhost []  Id:     1
+# Query_time: 1.500000  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 10
+use test;
+SET timestamp=1388567103;
+SELECT * FROM t;
+# User@Host: root[root] @ localhost []  Id:     1
+# Query_time: 1.200000  Lock_time: 0.000000 Rows_sent: 1  Rows_examined: 10
+SET timestamp=1388567103;
+SELECT * FROM u;
+`
+	checkEntries(t, log, []Entry{
+		{
+			Time: date("2014-01-01T09:05:03Z"), User: "root", Host: "localhost", ThreadID: 1, DB: "test",
+			QueryTime: 1500 * time.Millisecond, RowsSent: 1, RowsExamined: 10, Query: "SELECT * FROM t", Line: 1,
+		},
+		{
+			// Without # Time the time comes from SET timestamp.
+			Time: date("2014-01-01T09:05:03Z"), User: "root", Host: "localhost", ThreadID: 1, DB: "test",
+			QueryTime: 1200 * time.Millisecond, RowsSent: 1, RowsExamined: 10, Query: "SELECT * FROM u", Line: 7,
+		},
+	})
+}
+
+func TestParsePercona(t *testing.T) {
+	const log = `# Time: 2024-03-05T10:15:32.123456Z
+# User@Host: app[app] @ web1 [10.0.0.5]  Id:    42
+# Schema: shop  Last_errno: 0  Killed: 0
+# Query_time: 2.500000  Lock_time: 0.000100  Rows_sent: 10  Rows_examined: 50000  Rows_affected: 0
+# Bytes_sent: 1234  Tmp_tables: 0  Tmp_disk_tables: 0  Tmp_table_sizes: 0
+# QC_Hit: No  Full_scan: Yes  Full_join: No  Tmp_table: No  Tmp_table_on_disk: No
+SET timestamp=1709633732;
+SELECT * FROM orders;
+# Time: 2024-03-05T10:15:33.000000Z
+# User@Host: app[app] @ web1 [10.0.0.5]
+# Thread_id: 42  Schema:   Last_errno: 0  Killed: 0
+# Query_time: 0.100000  Lock_time: 0.000000  Rows_sent: 1  Rows_examined: 1  Rows_affected: 0
+SET timestamp=1709633733;
+SELECT 1;
+`
+	checkEntries(t, log, []Entry{
+		{
+			Time: date("2024-03-05T10:15:32.123456Z"), User: "app", Host: "web1", ThreadID: 42, DB: "shop",
+			QueryTime: 2500 * time.Millisecond, LockTime: 100 * time.Microsecond, RowsSent: 10, RowsExamined: 50000,
+			Query: "SELECT * FROM orders", Line: 1,
+		},
+		{
+			Time: date("2024-03-05T10:15:33Z"), User: "app", Host: "web1", ThreadID: 42, DB: "shop",
+			QueryTime: 100 * time.Millisecond, RowsSent: 1, RowsExamined: 1, Query: "SELECT 1", Line: 9,
+		},
+	})
+}
+
+func TestParseMariaDB(t *testing.T) {
+	const log = `/usr/sbin/mariadbd, Version: 10.11.6-MariaDB-log (MariaDB Server). started with:
+Tcp port: 3306  Unix socket: /run/mysqld/mysqld.sock
+Time		    Id Command	Argument
+# Time: 240305 10:15:32
+# User@Host: app[app] @ web1 [10.0.0.5]
+# Thread_id: 42  Schema: shop  QC_hit: No
+# Query_time: 2.500000  Lock_time: 0.000100  Rows_sent: 10  Rows_examined: 50000
+# Rows_affected: 0  Bytes_sent: 1234
+SET timestamp=1709633732;
+SELECT *
+FROM orders;
+# User@Host: app[app] @ web1 [10.0.0.5]
+# Thread_id: 43  Schema: hr  QC_hit: No
+# Query_time: 1.000000  Lock_time: 0.000000  Rows_sent: 1  Rows_examined: 100
+# Rows_affected: 0  Bytes_sent: 60
+SET timestamp=1709633732;
+SELECT COUNT(*) FROM staff;
+`
+	checkEntries(t, log, []Entry{
+		{
+			Time: date("2024-03-05T10:15:32Z"), User: "app", Host: "web1", ThreadID: 42, DB: "shop",
+			QueryTime: 2500 * time.Millisecond, LockTime: 100 * time.Microsecond, RowsSent: 10, RowsExamined: 50000,
+			Query: "SELECT *\nFROM orders", Line: 4,
+		},
+		{
+			Time: date("2024-03-05T10:15:32Z"), User: "app", Host: "web1", ThreadID: 43, DB: "hr",
+			QueryTime: time.Second, RowsSent: 1, RowsExamined: 100, Query: "SELECT COUNT(*) FROM staff", Line: 12,
+		},
+	})
+}
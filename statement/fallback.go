@@ -0,0 +1,189 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrUnverified is returned, wrapped, by Check for text the parser cannot
+// handle, so nothing can be said about what it does.
+var ErrUnverified = errors.New("cannot verify statement")
+
+// readKeywords are the first words a read-only statement can start with.
+var readKeywords = map[string]bool{
+	"SELECT": true,
+	"WITH":   true,
+	"TABLE":  true,
+	"VALUES": true,
+}
+
+// CheckUnparsed is a fallback for text the parser rejects, such as MySQL
+// 8 syntax the TiDB parser does not know (JSON_TABLE, LATERAL). It only
+// tokenizes sql, so it cannot prove the statement is read-only; the caller
+// must still run it in a read-only transaction, which refuses writes to
+// tables. What such a transaction does not stop is refused here: more than
+// one statement, anything not starting like a query (a statement with an
+// implicit commit would end the transaction), and INTO, which writes files
+// or variables.
+func CheckUnparsed(sql string) error {
+	if err := checkEscapes(sql); err != nil {
+		return err
+	}
+	tokens := tokenize(sql, true)
+	for len(tokens) > 0 && tokens[0] == "(" {
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return errors.New("no statement found")
+	}
+	if !readKeywords[tokens[0]] {
+		return fmt.Errorf("%w: %s", ErrNotAllowed, tokens[0])
+	}
+	for _, tok := range tokens {
+		switch tok {
+		case ";":
+			return fmt.Errorf("%w: more than one statement", ErrNotAllowed)
+		case "INTO":
+			return fmt.Errorf("%w: SELECT ... INTO", ErrNotAllowed)
+		}
+	}
+	return nil
+}
+
+// checkEscapes refuses sql if it splits into different tokens depending on
+// whether a backslash escapes the next character, that is, whether the
+// server runs with NO_BACKSLASH_ESCAPES. Then a quote ends a string for the
+// server where the check saw it continue, or the other way round.
+func checkEscapes(sql string) error {
+	if !slices.Equal(tokenize(sql, true), tokenize(sql, false)) {
+		return fmt.Errorf("%w: a backslash before a quote reads differently with NO_BACKSLASH_ESCAPES (double the quote instead)", ErrNotAllowed)
+	}
+	return nil
+}
+
+// tokenize splits sql into upper-cased words and single punctuation
+// characters, without a trailing terminator. Comments and quoted strings
+// and identifiers are dropped, except for the content of /*! version
+// comments and MariaDB's /*M! comments, which the server runs. backslash
+// says whether a backslash escapes the next character in a string.
+func tokenize(sql string, backslash bool) []string {
+	var (
+		tokens    []string
+		inVersion bool // inside /*! ... */
+	)
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case isSpace(c):
+			i++
+		case c == '#' || strings.HasPrefix(sql[i:], "--") && (i+2 == len(sql) || isSpace(sql[i+2])):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "/*!"), strings.HasPrefix(sql[i:], "/*M!"):
+			i += strings.Index(sql[i:], "!") + 1
+			for i < len(sql) && sql[i] >= '0' && sql[i] <= '9' {
+				i++
+			}
+			inVersion = true
+		case inVersion && strings.HasPrefix(sql[i:], "*/"):
+			i += 2
+			inVersion = false
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 4
+			}
+		case c == '\'' || c == '"' || c == '`':
+			i, _ = skipQuoted(sql, i, backslash)
+		case isWordChar(c):
+			start := i
+			for i < len(sql) && isWordChar(sql[i]) {
+				i++
+			}
+			tokens = append(tokens, strings.ToUpper(sql[start:i]))
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	// A trailing terminator is not a second statement.
+	for len(tokens) > 0 && tokens[len(tokens)-1] == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+// skipQuoted returns the index just past the quoted string or identifier
+// starting at i, and whether its closing quote was found. With backslash
+// set, backslash escapes apply to strings. A doubled quote stands for
+// itself.
+func skipQuoted(sql string, i int, backslash bool) (int, bool) {
+	q := sql[i]
+	for i++; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\' && backslash && q != '`':
+			i++
+		case sql[i] == q:
+			if i+1 < len(sql) && sql[i+1] == q {
+				i++
+				continue
+			}
+			return i + 1, true
+		}
+	}
+	return len(sql), false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c == '.' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// Terminated reports whether sql ends with a ; or the mysql client's \g or
+// \G, outside quotes and comments. Comments after the terminator are
+// allowed; an unclosed quote or comment means the text goes on.
+func Terminated(sql string) bool {
+	terminated := false
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case isSpace(c):
+			i++
+		case c == '#' || strings.HasPrefix(sql[i:], "--") && (i+2 == len(sql) || isSpace(sql[i+2])):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			var closed bool
+			if i, closed = skipQuoted(sql, i, true); !closed {
+				return false
+			}
+			terminated = false
+		case c == ';':
+			terminated = true
+			i++
+		case c == '\\' && i+1 < len(sql) && (sql[i+1] == 'g' || sql[i+1] == 'G'):
+			terminated = true
+			i += 2
+		default:
+			terminated = false
+			i++
+		}
+	}
+	return terminated
+}
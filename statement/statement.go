@@ -0,0 +1,159 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver"
+)
+
+// ErrNotAllowed is returned by Check for statements of a kind that was not
+// allowed.
+var ErrNotAllowed = errors.New("statement not allowed")
+
+// Kind is a coarse classification of a SQL statement.
+type Kind int
+
+const (
+	// Read covers SELECT, WITH, TABLE, VALUES and EXPLAIN of those.
+	Read Kind = iota
+	// Write covers INSERT, REPLACE, UPDATE and DELETE.
+	Write
+	// Other covers everything else: DDL, SET, CALL, LOAD DATA, etc.
+	Other
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	default:
+		return "other"
+	}
+}
+
+// Parse splits sql into statements using the TiDB parser.
+func Parse(sql string) ([]ast.StmtNode, error) {
+	nodes, _, err := parser.New().Parse(sql, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// Label returns a short human-readable name for a parsed statement.
+func Label(node ast.StmtNode) string {
+	if l := ast.GetStmtLabel(node); l != "other" {
+		return l
+	}
+	l := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	return strings.TrimSuffix(l, "Stmt")
+}
+
+// Classify returns the kind of a parsed statement.
+func Classify(node ast.StmtNode) Kind {
+	switch n := node.(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt:
+		if writesFile(node) {
+			return Other
+		}
+		return Read
+	case *ast.ExplainStmt:
+		// EXPLAIN ANALYZE executes the statement, plain EXPLAIN does not.
+		if !n.Analyze || n.Stmt == nil {
+			return Read
+		}
+		return Classify(n.Stmt)
+	case *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt:
+		return Write
+	default:
+		return Other
+	}
+}
+
+// CheckReadOnly parses sql and returns an error wrapping ErrNotAllowed
+// unless every statement in it is a Read.
+func CheckReadOnly(sql string) error {
+	return Check(sql, Read)
+}
+
+// mariaDBComment matches the start of a MariaDB executable comment. Its
+// version has six digits, which the parser would not read as a version.
+var mariaDBComment = regexp.MustCompile(`/\*M!\d*`)
+
+// Check parses sql and returns an error wrapping ErrNotAllowed unless
+// every statement in it is of one of the allowed kinds. Text the server
+// may split differently than the parser is refused as well: a backslash
+// before a quote, which depends on NO_BACKSLASH_ESCAPES. MariaDB's /*M!
+// comments are checked as code, since MariaDB runs them.
+func Check(sql string, allowed ...Kind) error {
+	if err := checkEscapes(sql); err != nil {
+		return err
+	}
+	nodes, err := Parse(mariaDBComment.ReplaceAllString(sql, "/*! "))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnverified, err)
+	}
+	if len(nodes) == 0 {
+		return errors.New("no statement found")
+	}
+	for _, n := range nodes {
+		k := Classify(n)
+		ok := false
+		for _, a := range allowed {
+			if k == a {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s (%s)", ErrNotAllowed, Label(n), k)
+		}
+	}
+	return nil
+}
+
+// IsCall reports whether node is a CALL, which may return several result
+// sets.
+func IsCall(node ast.StmtNode) bool {
+	_, ok := node.(*ast.CallStmt)
+	return ok
+}
+
+// intoFinder looks for SELECT ... INTO OUTFILE / DUMPFILE / @var.
+type intoFinder struct {
+	found bool
+}
+
+func (f *intoFinder) Enter(n ast.Node) (ast.Node, bool) {
+	if s, ok := n.(*ast.SelectStmt); ok && s.SelectIntoOpt != nil {
+		f.found = true
+	}
+	return n, f.found
+}
+
+func (f *intoFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+func writesFile(node ast.StmtNode) bool {
+	f := &intoFinder{}
+	node.Accept(f)
+	return f.found
+}
+
+// Fingerprint returns sql with literals replaced by ?, IN-lists and
+// multi-row VALUES collapsed to ( ... ), comments dropped and keywords and
+// whitespace normalised, together with the hex SHA-256 digest of that
+// text, as computed by the TiDB parser. Statements that differ only in
+// their literal values, or in the length of a value list, share both.
+func Fingerprint(sql string) (normalized, digest string) {
+	n, d := parser.NormalizeDigest(sql)
+	return n, d.String()
+}
@@ -0,0 +1,155 @@
+package statement
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		allowed []Kind
+		want    error // nil, ErrNotAllowed or ErrUnverified
+	}{
+		{"select", "SELECT * FROM t WHERE id = 1", []Kind{Read}, nil},
+		{"table", "TABLE t", []Kind{Read}, nil},
+		{"values", "VALUES ROW(1), ROW(2)", []Kind{Read}, nil},
+		{"cte select", "WITH c AS (SELECT 1) SELECT * FROM c", []Kind{Read}, nil},
+		{"cte delete", "WITH c AS (SELECT id FROM t) DELETE FROM t WHERE id IN (SELECT id FROM c)", []Kind{Read}, ErrNotAllowed},
+		{"version comment", "/*!40000 DELETE FROM t */", []Kind{Read}, ErrNotAllowed},
+		{"into outfile", "SELECT * FROM t INTO OUTFILE '/tmp/t.csv'", []Kind{Read}, ErrNotAllowed},
+		// The parser does not know these forms; CheckUnparsed refuses them.
+		{"into dumpfile", "SELECT 1 INTO DUMPFILE '/tmp/x'", []Kind{Read}, ErrUnverified},
+		{"into variable", "SELECT 1 INTO @a", []Kind{Read}, ErrUnverified},
+		{"explain delete", "EXPLAIN DELETE FROM t", []Kind{Read}, nil},
+		{"explain analyze delete", "EXPLAIN ANALYZE DELETE FROM t", []Kind{Read}, ErrNotAllowed},
+		{"explain analyze delete as dml", "EXPLAIN ANALYZE DELETE FROM t", []Kind{Read, Write}, nil},
+		{"second statement", "SELECT 1; DROP TABLE t", []Kind{Read}, ErrNotAllowed},
+		{"no backslash escapes", `SELECT 'a\' ; DROP TABLE t; -- '`, []Kind{Read}, ErrNotAllowed},
+		{"doubled quote", "SELECT 'it''s' FROM t", []Kind{Read}, nil},
+		{"mariadb comment", "SELECT 1 /*M! ; DROP TABLE t */", []Kind{Read}, ErrNotAllowed},
+		{"mariadb version comment", "/*M!100100 DELETE FROM t */", []Kind{Read}, ErrNotAllowed},
+		{"json_table", "SELECT * FROM JSON_TABLE('[1]', '$[*]' COLUMNS (a INT PATH '$')) AS j", []Kind{Read}, ErrUnverified},
+		{"lateral", "SELECT * FROM t, LATERAL (SELECT * FROM u WHERE u.id = t.id) AS x", []Kind{Read}, ErrUnverified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.sql, tt.allowed...)
+			switch {
+			case tt.want == nil && err != nil:
+				t.Errorf("Check(%q) = %v, want nil", tt.sql, err)
+			case tt.want != nil && !errors.Is(err, tt.want):
+				t.Errorf("Check(%q) = %v, want %v", tt.sql, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckUnparsed(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		ok   bool
+	}{
+		{"json_table", "SELECT * FROM JSON_TABLE('[1]', '$[*]' COLUMNS (a INT PATH '$')) AS j", true},
+		{"lateral", "SELECT * FROM t, LATERAL (SELECT 1) AS x;", true},
+		{"parenthesised", "(SELECT 1)", true},
+		{"cte", "WITH c AS (SELECT 1) SELECT * FROM c", true},
+		{"leading comment", "/* report */ -- daily\nSELECT 1", true},
+		{"quoted keywords", "SELECT 'x; DROP TABLE t', `into` FROM t", true},
+		{"doubled quote", "SELECT 'it''s; INTO' FROM t", true},
+		{"escaped backslash", `SELECT 'C:\\', 'x' FROM t`, true},
+		{"escaped quote", `SELECT 'it\'s; INTO' FROM t`, false},
+		{"no backslash escapes", `SELECT 'a\' ; DROP TABLE t; -- '`, false},
+		{"empty", "  -- nothing\n", false},
+		{"delete", "DELETE FROM t", false},
+		{"drop", "DROP TABLE t", false},
+		{"second statement", "SELECT 1; DROP TABLE t", false},
+		{"into outfile", "SELECT * FROM t INTO OUTFILE '/tmp/t.csv'", false},
+		{"into variable", "SELECT 1 INTO @a", false},
+		{"into dumpfile", "SELECT 1 INTO DUMPFILE '/tmp/x'", false},
+		{"version comment", "/*!40000 DELETE FROM t */", false},
+		{"version comment statement", "SELECT 1 /*!; DROP TABLE t */", false},
+		{"mariadb comment", "SELECT 1 /*M! ; DROP TABLE t */", false},
+		{"mariadb version comment", "SELECT 1 /*M!100100 INTO @a */", false},
+		{"plain comment", "SELECT 1 /* ; DROP TABLE t */", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckUnparsed(tt.sql)
+			if tt.ok && err != nil {
+				t.Errorf("CheckUnparsed(%q) = %v, want nil", tt.sql, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("CheckUnparsed(%q) = nil, want an error", tt.sql)
+			}
+		})
+	}
+}
+
+func TestWriteTargets(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want []Table
+	}{
+		{"SELECT * FROM t", nil},
+		{"INSERT INTO db.t (a) VALUES (1)", []Table{{"db", "t"}}},
+		{"REPLACE INTO t SELECT * FROM u", []Table{{"", "t"}}},
+		{"UPDATE t SET a = 1", []Table{{"", "t"}}},
+		{"UPDATE t JOIN u ON u.id = t.id SET t.a = u.a", []Table{{"", "t"}}},
+		{"UPDATE t AS x JOIN u AS y ON y.id = x.id SET y.a = 1", []Table{{"", "u"}}},
+		{"UPDATE t JOIN u ON u.id = t.id SET a = 1", []Table{{"", "t"}, {"", "u"}}},
+		{"DELETE FROM t WHERE id IN (SELECT id FROM u)", []Table{{"", "t"}}},
+		{"DELETE x FROM t AS x JOIN u ON u.id = x.id", []Table{{"", "t"}}},
+		{"DELETE FROM t, u USING t JOIN u JOIN v", []Table{{"", "t"}, {"", "u"}}},
+		{"EXPLAIN ANALYZE DELETE FROM t", []Table{{"", "t"}}},
+		{"EXPLAIN DELETE FROM t", nil},
+	}
+	for _, tt := range tests {
+		got, err := WriteTargets(tt.sql)
+		if err != nil {
+			t.Errorf("WriteTargets(%q): %v", tt.sql, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("WriteTargets(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestTerminated(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT 1;", true},
+		{"SELECT 1", false},
+		{"SELECT 1 \\G", true},
+		{"SELECT 1\\g", true},
+		{"SELECT 1;\n", true},
+		{"SELECT 1; -- done", true},
+		{"SELECT 1; /* done */", true},
+		{"SELECT ';", false},
+		{"SELECT ';'", false},
+		{"SELECT ';';", true},
+		{"SELECT 'it''s;", false},
+		{`SELECT 'a\';`, false},
+		{`SELECT 'a\\';`, true},
+		{"SELECT \"x;\"", false},
+		{"SELECT `a;b` FROM t", false},
+		{"SELECT 1 -- ;", false},
+		{"SELECT 1 # ;", false},
+		{"SELECT 1 /* ; */", false},
+		{"SELECT 1 /* ;", false},
+		{"SELECT 1 /*!;", false},
+		{"SELECT '\\G'", false},
+		{"SELECT 1;\nSELECT 2", false},
+	}
+	for _, tt := range tests {
+		if got := Terminated(tt.sql); got != tt.want {
+			t.Errorf("Terminated(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
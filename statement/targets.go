@@ -0,0 +1,125 @@
+package statement
+
+import (
+	"slices"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// Table is a table name as written in a statement. Schema is empty when
+// the name is not qualified.
+type Table struct {
+	Schema string
+	Name   string
+}
+
+// WriteTargets returns the tables the INSERT, REPLACE, UPDATE and DELETE
+// statements in sql modify, including those wrapped in EXPLAIN ANALYZE.
+// For a multi-table UPDATE only the tables named in SET are returned,
+// unless a column there is not qualified. Names that turn out to be CTEs
+// are returned as well; they do not exist as tables.
+func WriteTargets(sql string) ([]Table, error) {
+	nodes, err := Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	var tables []Table
+	for _, n := range nodes {
+		tables = append(tables, writeTargets(n)...)
+	}
+	return tables, nil
+}
+
+func writeTargets(node ast.StmtNode) []Table {
+	switch n := node.(type) {
+	case *ast.ExplainStmt:
+		if n.Analyze && n.Stmt != nil {
+			return writeTargets(n.Stmt)
+		}
+	case *ast.InsertStmt:
+		return tableNames(joinSources(n.Table))
+	case *ast.UpdateStmt:
+		sources := joinSources(n.TableRefs)
+		if len(sources) < 2 {
+			return tableNames(sources)
+		}
+		var targets []tableSource
+		for _, a := range n.List {
+			ref := a.Column.Table.L
+			if ref == "" {
+				return tableNames(sources)
+			}
+			targets = append(targets, matchSources(sources, ref)...)
+		}
+		return tableNames(targets)
+	case *ast.DeleteStmt:
+		sources := joinSources(n.TableRefs)
+		if !n.IsMultiTable || n.Tables == nil {
+			return tableNames(sources)
+		}
+		var targets []tableSource
+		for _, t := range n.Tables.Tables {
+			targets = append(targets, matchSources(sources, t.Name.L)...)
+		}
+		return tableNames(targets)
+	}
+	return nil
+}
+
+// tableSource is a table in a FROM or JOIN clause with its alias.
+type tableSource struct {
+	table *ast.TableName
+	alias string
+}
+
+// joinSources lists the tables joined in refs. Derived tables are left
+// out, since nothing can be written through them.
+func joinSources(refs *ast.TableRefsClause) []tableSource {
+	if refs == nil {
+		return nil
+	}
+	var sources []tableSource
+	var walk func(ast.ResultSetNode)
+	walk = func(n ast.ResultSetNode) {
+		switch n := n.(type) {
+		case *ast.Join:
+			walk(n.Left)
+			if n.Right != nil {
+				walk(n.Right)
+			}
+		case *ast.TableSource:
+			if t, ok := n.Source.(*ast.TableName); ok {
+				sources = append(sources, tableSource{table: t, alias: n.AsName.L})
+			} else if j, ok := n.Source.(*ast.Join); ok {
+				walk(j)
+			}
+		case *ast.TableName:
+			sources = append(sources, tableSource{table: n})
+		}
+	}
+	walk(refs.TableRefs)
+	return sources
+}
+
+// matchSources returns the sources ref refers to: the one with that alias,
+// or the unaliased ones with that name.
+func matchSources(sources []tableSource, ref string) []tableSource {
+	var matched []tableSource
+	for _, s := range sources {
+		if s.alias == ref || s.alias == "" && s.table.Name.L == ref {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+func tableNames(sources []tableSource) []Table {
+	tables := make([]Table, 0, len(sources))
+	for _, s := range sources {
+		t := Table{Schema: s.table.Schema.O, Name: s.table.Name.O}
+		if !slices.Contains(tables, t) {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}